@@ -0,0 +1,124 @@
+package appconfig
+
+import "fmt"
+import "strconv"
+import "strings"
+
+import log "github.com/sirupsen/logrus"
+
+// An Alias is an old name of a parameter that is still accepted on the
+// command-line (with the param's prefix), in environmental variables and in
+// config files. Values supplied under an alias are mapped onto the param's
+// key and a deprecation warning naming the replacement is logged.
+//
+// Once Options.Version reaches RemovedIn, the alias is rejected with an error
+// (wrapping ErrRemoved) and it is no longer listed by PrintUsage().
+type Alias struct {
+	Name      string // The old parameter name, e.g. "statsd_addr"
+	Since     string // Version in which the name was deprecated (informational), e.g. "1.4"
+	RemovedIn string // Version from which the name is rejected. Empty means it is never rejected.
+}
+
+// Returns the alias of p named name, if there is one.
+func findAlias(p Param, name string) *Alias {
+	for i := range p.Aliases {
+		if p.Aliases[i].Name == name {
+			return &p.Aliases[i]
+		}
+	}
+	return nil
+}
+
+// Reports whether the running version (Options.Version) is at or past the
+// alias' RemovedIn version.
+func (a Alias) isRemoved(version string) bool {
+	return a.RemovedIn != "" && version != "" && compareVersions(version, a.RemovedIn) >= 0
+}
+
+// Called whenever a value is found under an alias. Logs a deprecation warning,
+// or returns an error wrapping ErrRemoved if the alias has been removed.
+// where describes the alias as it was used, e.g. "environmental variable 'statsd_addr'".
+func checkAlias(alias Alias, where string, replacement string, version string) error {
+	if alias.isRemoved(version) {
+		return fmt.Errorf("%w: %s was removed in version %s; use %s instead", ErrRemoved, where, alias.RemovedIn, replacement)
+	}
+	since := ""
+	if alias.Since != "" {
+		since = " since version " + alias.Since
+	}
+	log.Warnf("%s is deprecated%s; use %s instead.", where, since, replacement)
+	return nil
+}
+
+// Describes the deprecated names of a param that are still accepted, for
+// PrintUsage(). Removed aliases are not listed.
+func (c *Config) aliasUsage(param string) []string {
+	var names []string
+	for _, alias := range c.params[param].Aliases {
+		if !alias.isRemoved(c.opts.Version) {
+			names = append(names, "'"+paramPrefix(c.params[param])+alias.Name+"'")
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("(deprecated names: %s)", strings.Join(names, ", "))}
+}
+
+// Moves values found under an alias in a config file (or stdin) layer onto
+// the param's key. A value under the param's own key takes precedence.
+func resolveAliases(l layer, params map[string]Param, version string) Errors {
+	var errs Errors
+	for _, param := range sortedKeys(params) {
+		for _, alias := range params[param].Aliases {
+			val, ok := l.vals[alias.Name]
+			if !ok {
+				continue
+			}
+			origin := l.originOf(alias.Name)
+			delete(l.vals, alias.Name)
+			where := fmt.Sprintf("Key '%s' in %s", alias.Name, origin)
+			if err := checkAlias(alias, where, fmt.Sprintf("'%s'", param), version); err != nil {
+				errs = append(errs, &ParamError{Param: param, Origin: origin, Value: val, Err: err})
+				continue
+			}
+			if _, ok := l.vals[param]; !ok {
+				l.vals[param] = val
+				l.origins[param] = origin
+			}
+		}
+	}
+	return errs
+}
+
+// Compares two dotted version strings numerically, part by part ("1.10" is
+// newer than "1.9"). A leading "v" is ignored and non-numeric parts are
+// compared as strings. Returns -1, 0 or 1.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		ap, bp := "0", "0"
+		if i < len(as) {
+			ap = as[i]
+		}
+		if i < len(bs) {
+			bp = bs[i]
+		}
+		an, aErr := strconv.Atoi(ap)
+		bn, bErr := strconv.Atoi(bp)
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case (aErr != nil || bErr != nil) && ap != bp:
+			if ap < bp {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
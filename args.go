@@ -0,0 +1,153 @@
+package appconfig
+
+import "fmt"
+import "os"
+import "path/filepath"
+import "strings"
+
+import log "github.com/sirupsen/logrus"
+
+// Name of the source of command-line arguments given in the environmental
+// variable named by Options.ArgsEnvVar, as used in Origin.Source.
+const SOURCE_ENV_ARGS = "env-args"
+
+// Reads the arguments in the environmental variable named by
+// Options.ArgsEnvVar (e.g. MYAPP_OPTS="-port=8080 -name='my app'"), and
+// parses them like the command-line. Returns nil if the variable isn't set.
+func processArgsEnvVar(params map[string]Param, name string, version string) (map[string]string, error) {
+	value := os.Getenv(name)
+	if name == "" || strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	log.Debugf("Processing command-line arguments in environmental variable %s...", name)
+	arguments, err := splitShellWords(value, false)
+	if err != nil {
+		err = fmt.Errorf("Cannot split environmental variable '%s': %v.", name, err)
+		log.Error(err)
+		return nil, err
+	}
+	if arguments, err = expandArgsFiles(arguments, nil); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	args, err := parseArguments(arguments, params, version)
+	if err != nil {
+		return nil, fmt.Errorf("Environmental variable '%s': %v", name, err)
+	}
+	return args, nil
+}
+
+// Replaces each "@file" argument with the arguments in the file, which are
+// split like a shell would, except that newlines are whitespace and lines
+// starting with "#" are comments. Files may name further files; "@@" at the
+// start of an argument stands for a literal "@". Relative file names are
+// relative to the working directory.
+func expandArgsFiles(arguments []string, reading []string) ([]string, error) {
+	expanded := make([]string, 0, len(arguments))
+	for _, argument := range arguments {
+		if strings.HasPrefix(argument, "@@") {
+			expanded = append(expanded, argument[1:])
+			continue
+		}
+		if !strings.HasPrefix(argument, "@") {
+			expanded = append(expanded, argument)
+			continue
+		}
+
+		file, err := filepath.Abs(argument[1:])
+		if err != nil {
+			return nil, fmt.Errorf("Cannot find arguments file '%s': %v.", argument[1:], err)
+		}
+		for _, f := range reading {
+			if f == file {
+				return nil, fmt.Errorf("Arguments file '%s' includes itself.", file)
+			}
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read arguments file: %v.", err)
+		}
+		log.Debugf("--> Reading arguments from file '%s'", file)
+		words, err := splitShellWords(string(data), true)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot split arguments file '%s': %v.", file, err)
+		}
+		words, err = expandArgsFiles(words, append(reading, file))
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, words...)
+	}
+	return expanded, nil
+}
+
+// Splits s into words with the quoting rules of a POSIX shell: words are
+// separated by unquoted blanks, single quotes preserve everything up to the
+// next single quote, double quotes preserve everything but the escapes \\,
+// \", \$, \` and \<newline>, and a backslash outside quotes escapes the next
+// character. There is no expansion of variables, globs or commands. With
+// comments, a "#" at the start of a word begins a comment up to the end of
+// the line.
+func splitShellWords(s string, comments bool) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false // distinguishes an empty quoted word ('') from no word
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '#' && comments && !inWord:
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '\\':
+			i++
+			if i == len(runes) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			if runes[i] != '\n' { // a backslash-newline joins lines
+				word.WriteRune(runes[i])
+				inWord = true
+			}
+		case r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			inWord = true
+			i = end
+		case r == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\\\"$`\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,87 @@
+package appconfig
+
+import "os"
+import "path/filepath"
+import "reflect"
+import "strings"
+import "testing"
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		comments bool
+		want     []string
+		err      string // expected error, "" if the input is valid
+	}{
+		{name: "blanks", input: " -port=80\t-debug \n\r -name x ", want: []string{"-port=80", "-debug", "-name", "x"}},
+		{name: "empty", input: "  \n ", want: nil},
+		{name: "single quotes", input: `-name='a "b" \n $x'`, want: []string{`-name=a "b" \n $x`}},
+		{name: "double quotes", input: `"a \"b\" \\ \$x \q"`, want: []string{`a "b" \ $x \q`}},
+		{name: "escapes", input: `a\ b \'c\' d\\`, want: []string{"a b", "'c'", `d\`}},
+		{name: "line continuation", input: "-na\\\nme \"x\\\ny\"", want: []string{"-name", "xy"}},
+		{name: "empty quoted words", input: `'' "" -x=''`, want: []string{"", "", "-x="}},
+		{name: "adjacent quotes", input: `a'b c'"d e"f`, want: []string{"ab cd ef"}},
+		{name: "comments", input: "# options\n-port=80 # the port\n-tag=a#b\n'#x'", comments: true, want: []string{"-port=80", "-tag=a#b", "#x"}},
+		{name: "no comments", input: "-port=80 # the port", want: []string{"-port=80", "#", "the", "port"}},
+		{name: "unicode", input: `-name='héllo wörld'`, want: []string{"-name=héllo wörld"}},
+		{name: "unterminated single quote", input: `-name='x`, err: "unterminated single quote"},
+		{name: "unterminated double quote", input: `-name="x\"`, err: "unterminated double quote"},
+		{name: "trailing backslash", input: `-name=x\`, err: "trailing backslash"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := splitShellWords(test.input, test.comments)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got %q, %v, want error %q", got, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpandArgsFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	common := write("common.args", "# shared\n-debug\n-name='my app'\n")
+	main := write("main.args", "-port=80\n@"+common+"\n@@literal\n")
+
+	got, err := expandArgsFiles([]string{"-first", "@" + main, "@@user", "-last"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-first", "-port=80", "-debug", "-name=my app", "@literal", "@user", "-last"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Cycles are reported instead of recursing forever
+	a := filepath.Join(dir, "a.args")
+	b := write("b.args", "@"+a)
+	write("a.args", "-x @"+b)
+	if _, err := expandArgsFiles([]string{"@" + a}, nil); err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Errorf("got %v, want an error for the cycle", err)
+	}
+
+	if _, err := expandArgsFiles([]string{"@" + filepath.Join(dir, "missing.args")}, nil); err == nil {
+		t.Error("no error for a missing file")
+	}
+	bad := write("bad.args", "-name='x")
+	if _, err := expandArgsFiles([]string{"@" + bad}, nil); err == nil || !strings.Contains(err.Error(), "unterminated single quote") {
+		t.Errorf("got %v, want the split error", err)
+	}
+}
@@ -6,21 +6,45 @@
 //
 // Features:
 // - Automatic support beyond command-line arguments (Go's flag package) to configuration files and environmental variables.
+// - Command-line arguments from an environmental variable (like JAVA_OPTS) with shell quoting, and from @argsfile response files
 // - Configuration files that contain multiple configurations or share configuration data with other apps.
+// - Layer several configuration files (repeated switch, globs and conf.d directories)
+// - Discover configuration files in search paths (working directory, XDG directories, /etc/<app>, executable directory)
+// - Opt-in ${VAR} interpolation of environmental variables and other parameters in values
+// - Comments, trailing commas and other JSONC/JSON5 extensions in configuration files
+// - Configuration files can "include" other files and configuration nodes can "extends" other nodes
 // - Specify whether a parameter is required
 // - Specify a type (e.g., int, bool, string) for your parameter
 // - Support for unmarshalled JSON objects as parameter values
+// - JSON objects and lists in environmental variables and command-line values, and -set path=value and JSON Merge Patch overlays
+// - Path parameters resolved relative to the configuration file that set them
+// - Pluggable sources of values (Source interface), placed anywhere in the order of precedence and optionally watched for changes
+// - Configurable order of precedence, and parameters restricted to certain sources
+// - Remote configuration over HTTP(S) (JSON or YAML) with change polling and a last known good copy
+// - Consul KV and etcd v3 sources with change notification
+// - HashiCorp Vault secrets source, and sensitive parameters redacted from logs, errors and output
+// - Values from helper commands (like git credential helpers), with timeouts and caching
+// - Directories with one file per parameter, such as Kubernetes ConfigMap and Secret volumes, reloaded when swapped
+// - Per-parameter merge of objects and lists across layers (replace, deep-merge, append, union)
+// - Declare relationships between parameters (required-if, conflicts, one-of groups)
+// - Strict mode reporting unknown keys in configuration files and prefixed environmental variables, with suggestions
+// - A library of type-safe validators (ranges, lengths, regexps, URLs, addresses, paths)
 //
 // A full example implementation is available in example/.
 //
 package appconfig
 
+import "context"
+import "errors"
 import "fmt"
 import "os"
 import "strings"
 import "strconv"
 import "reflect"
 import "encoding/json"
+import "io"
+import "sync"
+import "time"
 import (
 	log "github.com/sirupsen/logrus"
 	"sort"
@@ -42,12 +66,16 @@ const (
 	PARAM_STRING            ParamType = iota // Converts nil to ""
 	PARAM_INT               ParamType = 1    // Converts environmental variables and command-line values from string to int
 	PARAM_BOOL              ParamType = 2    // Converts environmental variables and command-line values from string to bool
-	PARAM_OBJECT            ParamType = 3    // Currently a noop
+	PARAM_OBJECT            ParamType = 3    // Decodes environmental variables and command-line values holding a JSON object or array. With MERGE_DEEP, such an object is applied as a JSON Merge Patch to the layers below.
+	PARAM_LIST              ParamType = 4    // Converts JSON arrays and other slices to []interface{}, and environmental variables and command-line values by decoding a JSON array or else splitting on commas
+	PARAM_PATH              ParamType = 5    // A file system path. Expands "~" and environmental variables and resolves relative paths against the directory of the config file that supplied the value (or the working directory)
 	PARAM_CONFIG_READ_ENV   ParamType = -1   //Value represents whether environment variables should be read and used (allows explicit control)
-	PARAM_CONFIG_JSON_FILE  ParamType = -2   // Value represents the JSON config file.
+	PARAM_CONFIG_JSON_FILE  ParamType = -2   // Value represents the JSON config file(s): a list of files, globs and conf.d directories separated by os.PathListSeparator. Repeat the switch to add more.
 	PARAM_CONFIG_JSON_STDIN ParamType = -3   // Value represents the JSON input from stdin (standard input)
-	PARAM_CONFIG_NODE       ParamType = -4   // Specifies a different "root node" in the config file (shared by both json-inputs).
+	PARAM_CONFIG_NODE       ParamType = -4   // Specifies a different "root node" in the config file (shared by both json-inputs). A comma-separated list of nodes (or dotted paths like "apps.proxy") is merged left to right; a node can inherit from others with an "extends" key.
 	PARAM_USAGE             ParamType = -5   // Usage flag. Typically -h, -help or --help.
+	PARAM_CONFIG_SET        ParamType = -6   // Value is a "path=value" assignment applied to the merged values before validation, e.g. -set=ProxyRules.api.ScriptFile=api.js. Repeat the switch (or use one line per assignment) for more.
+	PARAM_CONFIG_JSON_PATCH ParamType = -7   // Value is a JSON Merge Patch (RFC 7396) of param values applied to the merged values before validation, e.g. -config-json='{"port": 8080}'. Repeat the switch for more.
 )
 
 // This is the struct you use to specify the properties of each parameter.
@@ -55,13 +83,51 @@ const (
 // an array of this struct with the parameter name being the map index.
 //
 // None of the fields are required.
+//
+// When Interpolate is set, references in string values (including strings
+// nested in objects and lists) are expanded after all sources have been
+// merged, and before type conversion and validation:
+//
+//   ${name}         the value of param "name" if there is one, otherwise environmental variable "name"
+//   ${name:-word}   like ${name}, but word (itself expanded) if the value is unset or empty
+//   $$              a literal "$"
+//
+// Reference cycles are reported as errors wrapping ErrInterpolation.
 type Param struct {
-	Type           ParamType              // Use if you want explicit type conversion
-	Default        interface{}            // Default value. If ommited, initialized value is based on Type.
-	Usage          string                 // Description of parameter; used by `PrintUsage(message string)`
-	Required       bool                   // Is the parameter required? Default is false.
-	PrefixOverride string                 // Override the argument identifier prefix. Default is "-".
-	Validate       func(interface{}) bool //Set a function that can validate the parameter upon parsing.
+	Type           ParamType               // Use if you want explicit type conversion
+	Default        interface{}             // Default value. If ommited, initialized value is based on Type.
+	Usage          string                  // Description of parameter; used by `PrintUsage(message string)`
+	Required       bool                    // Is the parameter required? Default is false.
+	PrefixOverride string                  // Override the argument identifier prefix. Default is "-".
+	Validate       func(interface{}) bool  //Set a function that can validate the parameter upon parsing.
+	ValidateErr    func(interface{}) error // Like Validate, but returns an error explaining why the value was rejected (nil if valid).
+	RequiredIf     []string                // The parameter becomes required when any of these params is set. A Default satisfies the requirement.
+	ConflictsWith  []string                // The parameter must not be set together with any of these params.
+	ExactlyOneOf   []string                // Exactly one of this param and these params must be set.
+	AtLeastOneOf   []string                // At least one of this param and these params must be set.
+	Rules          []Rule                  // Built-in or custom validators (see IntRange(), URL(), ...); described in PrintUsage(). Not applied while the param has neither a Default nor a value.
+	Aliases        []Alias                 // Old names that are still accepted, with deprecation metadata.
+	Merge          MergeStrategy           // How values from each layer combine with the layers below. Default is MERGE_REPLACE.
+	Interpolate    bool                    // Expand ${...} references to other params and environmental variables in the value (see above).
+	Sensitive      bool                    // The value is a secret, such as a password. It is redacted in logs, errors, PrintUsage() and ToJson().
+	Sources        []string                // Names of the only sources (SOURCE_* or Source.Name()) the value may come from besides Default. Values from other sources are errors wrapping ErrSource. Empty means any source. SOURCE_ARGS doesn't cover SOURCE_ENV_ARGS (Options.ArgsEnvVar), which must be listed separately. Unknown names are DefinitionErrors.
+}
+
+// The values supplied by one source (a config file, stdin, environmental
+// variables or the command-line). Layers are applied in order on top of the
+// defaults, each overriding the previous.
+type layer struct {
+	origin    Origin                 // where the values came from
+	origins   map[string]Origin      // per-key origins that differ from origin, e.g. for values from included files
+	vals      map[string]interface{} // values by param key. nil values are ignored.
+	sensitive bool                   // the values are secrets, see Tree.Sensitive
+}
+
+func (l layer) originOf(key string) Origin {
+	if origin, ok := l.origins[key]; ok {
+		return origin
+	}
+	return l.origin
 }
 
 // This is the object that's returned from appconfig.NewConfig(). They key
@@ -69,8 +135,54 @@ type Param struct {
 //   Get(key string) interface{} // returns value of parameter key
 //   PrintUsage(message string)   // prints usage with optional preceeding message
 type Config struct {
-	values map[string]interface{} // use Get() to retreive the values
-	params map[string]Param       // NewConfig() constructor values are kept as reference for other Config methods
+	values    map[string]interface{} // use Get() to retreive the values
+	origins   map[string]Origin      // where each value came from. Params left at their zero value have no entry.
+	params    map[string]Param       // NewConfig() constructor values are kept as reference for other Config methods
+	opts      Options                // NewConfigWithOptions() options, also kept for other Config methods
+	files     []string               // config files read, see ConfigFiles()
+	sources   []Source               // sources in increasing order of precedence, see Watch()
+	sensitive map[string]bool        // params whose value came from a source of sensitive values, see Sensitive()
+	input     *configInput           // command-line arguments and stdin, shared with reloads, see Watch()
+}
+
+// What is read only once per NewConfigWithOptions() and reused on reloads
+// (see Config.Watch()): the command-line, Options.ArgsEnvVar and stdin.
+type configInput struct {
+	args    map[string]string // command-line arguments, by param name
+	envArgs map[string]string // arguments in Options.ArgsEnvVar, by param name
+
+	stdinOnce sync.Once
+	stdin     []byte
+	stdinErr  error
+}
+
+// Stdin can only be read once, so what was read is kept for reloads.
+func (in *configInput) readStdin() ([]byte, error) {
+	in.stdinOnce.Do(func() {
+		in.stdin, in.stdinErr = io.ReadAll(os.Stdin)
+	})
+	return in.stdin, in.stdinErr
+}
+
+// Options control how NewConfigWithOptions() loads the configuration.
+// The zero value gives the behavior of NewConfig().
+type Options struct {
+	Validate func(*Config) error // Called with the loaded config to check rules that span several params. Not called if individual params already failed.
+	Version  string              // Version of the running app. Aliases whose RemovedIn is at or below this version are rejected.
+
+	RelaxedJson bool       // Accept comments, trailing commas, unquoted keys and other JSONC/JSON5 extensions in all config files and stdin, not just in .jsonc and .json5 files.
+	EnvPrefix   string     // If set, environmental variables are read as EnvPrefix + the upper-cased param name with "-" and "." replaced by "_", e.g. "MYAPP_STATSD_ADDR".
+	ArgsEnvVar  string     // Name of an environmental variable (e.g. "MYAPP_OPTS") holding further command-line arguments, split with shell quoting rules. They override environmental variables (even if PARAM_CONFIG_READ_ENV is false) and are overridden by the actual command-line.
+	Strict      StrictMode // Whether keys in config files (and EnvPrefix environmental variables) that don't match any param are ignored, logged or errors.
+
+	AppName          string   // Name of the app. If set (and SearchPaths isn't), config files are looked up in DefaultSearchPaths(AppName).
+	SearchPaths      []string // Directories, in decreasing priority, in which relative config files named by the PARAM_CONFIG_JSON_FILE param's Default are looked up. Not used when the file is given on the command-line.
+	MergeSearchPaths bool     // Read the config file found in every search path (system, then user, then project level, as git-config does) instead of just the first one found.
+
+	FilePollInterval time.Duration // How often Config.Watch() checks the config files for changes. Default is 10 seconds.
+
+	Sources    []SourceAt // Additional sources of values, such as remote configuration services, each placed at a chosen precedence.
+	Precedence []string   // Names of all sources (SOURCE_* and Source.Name()) in increasing order of precedence, replacing the default order file, stdin, env, env-args (if ArgsEnvVar is set), command-line. Defaults always come first.
 }
 
 // Level type
@@ -101,10 +213,10 @@ const (
 // Example:
 //
 //   params := make(map[string]appconfig.Param)
-//   params["config"] = appconfig.Param{Type:appconfig.PARAM_CONFIG_JSON, Default:"polyverse.json", Usage:"JSON configuration file.", Required:false}
-//   params["proxy-addr"] = appconfig.Param{Default:":8080", Usage:"List to [address]:port.", Required:true}
-//   params["statsd_addr"] = appconfig.Param{Usage:"StatsD address:port."}
-//   config := NewConfig(params)
+//   params["config"] = appconfig.Param{Type:appconfig.PARAM_CONFIG_JSON_FILE, Default:"polyverse.json", Usage:"JSON configuration file.", Required:false}
+//   params["proxy-addr"] = appconfig.Param{Default:":8080", Usage:"Listen on [address]:port."}
+//   params["statsd_addr"] = appconfig.Param{Usage:"StatsD address:port.", Required:true}
+//   config, err := appconfig.NewConfig(params)
 //
 // There are a lot of debug-level messages sent to syslog.
 //
@@ -115,18 +227,44 @@ const (
 //   ? [= Sender appconfig] [<= Level debug] file appconfig.log
 //
 func NewConfig(params map[string]Param) (Config, error) {
-	config := Config{values: make(map[string]interface{}), params: params} // initialize the return value
+	return NewConfigWithOptions(params, Options{})
+}
+
+// Same as NewConfig() but with Options that change how the configuration is
+// loaded and checked.
+func NewConfigWithOptions(params map[string]Param, opts Options) (Config, error) {
+	config := Config{values: make(map[string]interface{}), origins: make(map[string]Origin), params: params, opts: opts, sensitive: make(map[string]bool)} // initialize the return value
+
+	// Catch mistakes in the param definitions before looking at any values
+	if err := ValidateParams(params); err != nil {
+		log.WithFields(log.Fields{"err": err}).Errorf("Invalid parameter definitions.")
+		return config, err
+	}
+	if err := validateParamSources(params, opts.Sources); err != nil {
+		log.WithFields(log.Fields{"err": err}).Errorf("Invalid parameter definitions.")
+		return config, err
+	}
 
 	// Enumerate the command-line arguments
-	args, err := processCommandLine(params)
+	args, err := processCommandLine(params, opts.Version)
 	if err != nil {
 		log.WithFields(log.Fields{"err": err}).Errorf("Error processing command-line.")
 		config.PrintUsage(err.Error())
 		os.Exit(1)
 	}
 
+	// Command-line arguments in Options.ArgsEnvVar, which the actual
+	// command-line overrides
+	envArgs, err := processArgsEnvVar(params, opts.ArgsEnvVar, opts.Version)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Errorf("Error processing command-line arguments in %s.", opts.ArgsEnvVar)
+		config.PrintUsage(err.Error())
+		os.Exit(1)
+	}
+	input := &configInput{args: args, envArgs: envArgs}
+
 	// Before proceeding, let's check for the PARAM_USAGE types and return early if it's set to true
-	b, err := isCommandLineUsageTypeTrue(args, &config)
+	b, err := isCommandLineUsageTypeTrue(input.allArgs(), &config)
 	if err != nil {
 		log.WithFields(log.Fields{"err": err}).Errorf("Error determining whether usage flag is set.")
 		os.Exit(1)
@@ -134,73 +272,111 @@ func NewConfig(params map[string]Param) (Config, error) {
 		return config, nil // usage flag .value[param]true is set from isCommandLineUsageTypeTrue()
 	}
 
-	envs := make(map[string]string)
-	if ok, _ := strconv.ParseBool(getPreliminaryConfigValue(config, args, params, PARAM_CONFIG_READ_ENV)); ok {
-		var err error
-		// Check to see if environmental variables matching the parameter names exists
-		envs, err = getValsFromEnvVars(params)
-		if err != nil {
-			log.WithFields(log.Fields{"err": err}).Errorf("Error processing command-line.")
-			os.Exit(1)
+	return loadConfig(params, opts, input)
+}
+
+// The command-line arguments, overriding those in Options.ArgsEnvVar.
+func (in *configInput) allArgs() map[string]string {
+	allArgs := make(map[string]string)
+	for _, vals := range []map[string]string{in.envArgs, in.args} {
+		for param, value := range vals {
+			allArgs[param] = value
 		}
 	}
+	return allArgs
+}
 
-	configJson := getPreliminaryConfigValue(config, args, params, PARAM_CONFIG_JSON_FILE)
-	configNode := getPreliminaryConfigValue(config, args, params, PARAM_CONFIG_NODE)
+// Loads the configuration from all sources, with the command-line arguments
+// already parsed. Called by NewConfigWithOptions() and on every reload, so it
+// returns all errors instead of exiting.
+func loadConfig(params map[string]Param, opts Options, input *configInput) (Config, error) {
+	config := Config{values: make(map[string]interface{}), origins: make(map[string]Origin), params: params, opts: opts, sensitive: make(map[string]bool), input: input}
+	args, envArgs, allArgs := input.args, input.envArgs, input.allArgs()
 
-	configFileVals := make(map[string]interface{}) // configJson file will be unmarshalled into this map
-	if configJson != "" {
-		log.Debugf("Reading config file: file = '%s', node = '%s'", configJson, configNode)
+	var errs Errors // every missing, unconvertible and invalid value is collected and reported together
 
-		if f, err := os.Open(configJson); err != nil {
-			log.Errorf(err.Error()) // send to syslog
-			os.Exit(1)
-		} else { // opened file successfully
-			configFileVals = parseJsonFromFile(f, configJson, configNode)
+	envs := make(map[string]string)
+	if ok, _ := strconv.ParseBool(getPreliminaryConfigValue(config, allArgs, params, PARAM_CONFIG_READ_ENV)); ok {
+		var envErrs Errors
+		// Check to see if environmental variables matching the parameter names (or their aliases) exists
+		envs, envErrs = getValsFromEnvVars(params, opts.EnvPrefix, opts.Version)
+		errs = append(errs, envErrs...)
+		if opts.EnvPrefix != "" {
+			errs = append(errs, checkUnknownKeys(opts.Strict, unknownEnvVars(params, opts))...)
 		}
-	} else {
-		log.Debugf("No configuration file specified.")
 	}
 
-	configStdinVals := make(map[string]interface{}) //ConfigJson from stdin will be unmarshalled into this map
-	if ok, _ := strconv.ParseBool(getPreliminaryConfigValue(config, args, params, PARAM_CONFIG_JSON_STDIN)); ok {
-		configStdinVals = parseJsonFromFile(os.Stdin, "stdin (standard input)", configNode)
+	configJson := getPreliminaryConfigValue(config, allArgs, params, PARAM_CONFIG_JSON_FILE)
+	configNode := getPreliminaryConfigValue(config, allArgs, params, PARAM_CONFIG_NODE)
+	if searchPaths := opts.searchPaths(); len(searchPaths) > 0 && !isOnCommandLine(config, allArgs, PARAM_CONFIG_JSON_FILE) {
+		configJson = searchConfigFiles(configJson, searchPaths, opts.MergeSearchPaths)
+	}
+	readStdin, _ := strconv.ParseBool(getPreliminaryConfigValue(config, allArgs, params, PARAM_CONFIG_JSON_STDIN))
+
+	// Values from config files, stdin, environmental variables, Options.ArgsEnvVar
+	// and the command-line, in increasing order of precedence, with the
+	// sources of Options.Sources in between
+	builtins := []Source{
+		&fileSource{config: &config, configJson: configJson, configNode: configNode},
+		&stdinSource{config: &config, read: readStdin, input: input},
+		&stringSource{name: SOURCE_ENV, vals: envs, params: params},
+	}
+	if opts.ArgsEnvVar != "" {
+		builtins = append(builtins, &stringSource{name: SOURCE_ENV_ARGS, file: opts.ArgsEnvVar, vals: envArgs, params: params})
+	}
+	builtins = append(builtins, &stringSource{name: SOURCE_ARGS, vals: args, params: params})
+	sources, err := orderSources(builtins, opts.Sources, opts.Precedence)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Errorf("Invalid sources.")
+		return config, err
 	}
+	config.sources = sources
+	layers, loadErrs := loadSources(context.Background(), sources, map[string]bool{SOURCE_ENV: true, SOURCE_ENV_ARGS: true, SOURCE_ARGS: true}, configNode, params, opts)
+	errs = append(errs, loadErrs...)
 
 	log.Debugf("Finalizing configuration values...")
-	for param := range params {
+	for _, param := range sortedKeys(params) {
 		log.Debugf("--> Processing param: %s", param)
 		if params[param].Default != nil {
-			config.values[param] = params[param].Default
-			log.Debugf("----> Setting default: %s = %v (type: %s)", param, params[param].Default, reflect.TypeOf(params[param].Default))
+			config.values[param] = copyValue(params[param].Default)
+			config.origins[param] = Origin{Source: SOURCE_DEFAULT}
+			log.Debugf("----> Setting default: %s = %v (type: %s)", param, redact(params[param].Sensitive, params[param].Default), reflect.TypeOf(params[param].Default))
 		} else {
 			log.Debugf("----> No default value provided.")
 		}
-		if configFileVals[param] != nil {
-			config.values[param] = configFileVals[param]
-			log.Debugf("----> Config file override: %s = %v (type: %s)", param, configFileVals[param], reflect.TypeOf(configFileVals[param]))
-		}
-		if configStdinVals[param] != nil {
-			config.values[param] = configStdinVals[param]
-			log.Debugf("----> Config stdin (standard input) override: %s = %v (type: %s)", param, configStdinVals[param], reflect.TypeOf(configStdinVals[param]))
-		}
-		if envs[param] != "" {
-			config.values[param] = envs[param]
-			log.Debugf("----> Environmental variable override: %s = %v (type: %s)", param, args[param], reflect.TypeOf(args[param]))
-		}
-		if args[param] != "" {
-			config.values[param] = args[param]
-			log.Debugf("----> Command-line override: %s = %v (type: %s)", param, args[param], reflect.TypeOf(args[param]))
+		for _, l := range layers {
+			if l.vals[param] != nil && !params[param].allowsSource(l.originOf(param).Source) {
+				errs = append(errs, &ParamError{Param: param, Origin: l.originOf(param), Value: l.vals[param], Err: fmt.Errorf("%w; allowed: %s", ErrSource, strings.Join(params[param].Sources, ", "))})
+				continue
+			}
+			if l.vals[param] != nil {
+				config.values[param] = mergeValue(params[param], config.values[param], l.vals[param])
+				config.origins[param] = l.originOf(param)
+				if l.sensitive {
+					config.sensitive[param] = true
+				}
+				log.Debugf("----> Override from %s: %s = %v (type: %s)", config.origins[param], param, redact(config.Sensitive(param), l.vals[param]), reflect.TypeOf(l.vals[param]))
+			}
 		}
+	}
+
+	// Apply the PARAM_CONFIG_JSON_PATCH and PARAM_CONFIG_SET overlays on top of
+	// all layers
+	errs = append(errs, applyOverlays(&config, layers)...)
 
+	// Expand ${...} references once all params have their layered values, so
+	// params can refer to each other regardless of order
+	errs = append(errs, interpolateValues(&config)...)
+
+	for _, param := range sortedKeys(params) {
+		log.Debugf("--> Converting and validating param: %s", param)
 		if _, ok := config.values[param]; !ok {
 			if params[param].Required {
-				err := fmt.Errorf("Missing required parameter '%s'.", param)
-				log.Errorf(err.Error())
-				return config, err
+				errs = append(errs, &ParamError{Param: param, Err: ErrMissing})
+				continue
 			}
 			switch params[param].Type {
-			case PARAM_STRING, PARAM_CONFIG_JSON_FILE, PARAM_CONFIG_NODE:
+			case PARAM_STRING, PARAM_PATH, PARAM_CONFIG_JSON_FILE, PARAM_CONFIG_NODE, PARAM_CONFIG_SET, PARAM_CONFIG_JSON_PATCH:
 				{
 					config.values[param] = ""
 				}
@@ -212,46 +388,70 @@ func NewConfig(params map[string]Param) (Config, error) {
 				{
 					config.values[param] = false
 				}
+			case PARAM_LIST:
+				{
+					config.values[param] = []interface{}{}
+				}
 			}
 		}
 
-		if _, ok := config.values[param]; ok {
-			switch params[param].Type {
-			case PARAM_BOOL:
-				{
-					if reflect.TypeOf(config.values[param]).Name() == "string" {
-						config.values[param], _ = strconv.ParseBool(config.values[param].(string))
-						log.Debugf("----> Type mismatch. converted string to bool: %s = %v (type: %s)", param, config.values[param], reflect.TypeOf(config.values[param]))
-					}
-				}
-			case PARAM_INT:
-				{
-					if reflect.TypeOf(config.values[param]).Name() == "string" {
-						config.values[param], _ = strconv.Atoi(config.values[param].(string))
-						log.Debugf("----> Type mismatch. converted string to int: %s = %v (type: %s)", param, config.values[param], reflect.TypeOf(config.values[param]))
-					} else if reflect.TypeOf(config.values[param]).Name() == "float64" { //when reading from JSON
-						config.values[param] = int(config.values[param].(float64))
-						log.Debugf("----> Type mismatch. converted float64 to int: %s = %v (type: %s)", param, config.values[param], reflect.TypeOf(config.values[param]))
-					}
+		if value, ok := config.values[param]; ok {
+			converted, err := convertValue(params[param].Type, value)
+			if err != nil {
+				errs = append(errs, &ParamError{Param: param, Origin: config.origins[param], Value: value, Err: err})
+				continue // validators expect a value of the proper type
+			}
+			if reflect.TypeOf(converted) != reflect.TypeOf(value) {
+				config.values[param] = converted
+				log.Debugf("----> Type mismatch. converted %s to %s: %s = %v", reflect.TypeOf(value), reflect.TypeOf(converted), param, redact(config.Sensitive(param), converted))
+			}
+			if params[param].Type == PARAM_PATH {
+				path, err := resolvePath(converted.(string), config.origins[param])
+				if err != nil {
+					errs = append(errs, &ParamError{Param: param, Origin: config.origins[param], Value: value, Err: err})
+					continue
 				}
+				config.values[param] = path
+				log.Debugf("----> Resolved path: %s = %v", param, redact(config.Sensitive(param), path))
 			}
 		}
 
-		log.Debugf("Validating configuration values against validator functions...")
-		if validate := params[param].Validate; validate != nil {
-			log.Debugf("----> Validator found for param %s", param)
-			if value, ok := config.values[param]; ok {
-				log.Debug("----> Validating param %s value %v", param, value)
-				if !validate(value) {
-					err := fmt.Errorf("Validation failed for param %s with value %v", param, value)
-					log.Errorf(err.Error())
-					return config, err
-				}
+		log.Debugf("----> Validating param %s against validator functions...", param)
+		if value, ok := config.values[param]; ok {
+			p := params[param]
+			if _, set := config.origins[param]; !set {
+				p.Rules = nil // an optional param that was never set only has the zero value of its Type
+			}
+			if err := validateValue(p, value); err != nil {
+				errs = append(errs, &ParamError{Param: param, Origin: config.origins[param], Value: value, Err: err})
+			}
+		}
+	}
+
+	log.Debugf("Checking constraints between params...")
+	errs = append(errs, checkConstraints(&config)...)
+
+	if len(errs) == 0 && opts.Validate != nil {
+		log.Debugf("Validating configuration against the Options.Validate function...")
+		if err := opts.Validate(&config); err != nil {
+			var all Errors
+			if errors.As(err, &all) {
+				errs = append(errs, all...)
+			} else {
+				errs = append(errs, err)
 			}
 		}
 	}
 
-	log.Debugf("Done. Final config values: %v", config.values)
+	if len(errs) > 0 {
+		config.redactErrors(errs)
+		for _, err := range errs {
+			log.Error(err)
+		}
+		return config, errs
+	}
+
+	log.Debugf("Done. Final config values: %v", config.redactedValues(config.values))
 	return config, nil
 }
 
@@ -346,13 +546,20 @@ func (c *Config) PrintUsage(message string) {
 
 		def := c.params[param].Default
 		if def != nil {
-			def = fmt.Sprintf("(default: %v)", def)
+			def = fmt.Sprintf("(default: %v)", redact(c.params[param].Sensitive, def))
 		} else {
 			def = ""
 		}
 
 		fmt.Printf(" %s  ", padded)
-		description := fmt.Sprintf("%s %s", c.params[param].Usage, def)
+		description := strings.Join(append(append([]string{c.params[param].Usage}, c.aliasUsage(param)...), c.constraintUsage(param)...), " ")
+		for _, rule := range c.params[param].Rules {
+			description = fmt.Sprintf("%s (must be %s)", description, rule.Description)
+		}
+		if len(c.params[param].Sources) > 0 {
+			description = fmt.Sprintf("%s (only from: %s)", description, strings.Join(c.params[param].Sources, ", "))
+		}
+		description = fmt.Sprintf("%s %s", description, def)
 		words := strings.Fields(description)
 
 		width := 80 - maxlen
@@ -385,12 +592,32 @@ func (c *Config) ToJson() (string, error) {
 	jsonVals := make(map[string]interface{})
 	for param := range c.params {
 		if c.params[param].Type >= 0 {
-			jsonVals[param] = c.values[param]
+			jsonVals[param] = redact(c.Sensitive(param), c.values[param])
 		}
 	}
 
+	// Write the values to the last of the selected nodes and leave the others
+	// empty, so the output parses back to the same values with the same
+	// PARAM_CONFIG_NODE setting.
 	jsonTopLevel := make(map[string]interface{})
-	jsonTopLevel[jsonConfigNode] = jsonVals
+	paths := splitNodeList(jsonConfigNode)
+	if len(paths) == 0 {
+		jsonTopLevel[jsonConfigNode] = jsonVals
+	}
+	for i, path := range paths {
+		node := jsonTopLevel
+		for _, name := range strings.Split(path, ".") {
+			if _, ok := node[name].(map[string]interface{}); !ok {
+				node[name] = make(map[string]interface{})
+			}
+			node = node[name].(map[string]interface{})
+		}
+		if i == len(paths)-1 {
+			for param, value := range jsonVals {
+				node[param] = value
+			}
+		}
+	}
 	jsonbytes, err := json.MarshalIndent(jsonTopLevel, "", "	")
 	return string(jsonbytes), err
 }
@@ -401,16 +628,30 @@ func SetLogLevel(level Level) {
 	log.Debugf("SetLogLevel(): %s", log.GetLevel().String())
 }
 
-func processCommandLine(params map[string]Param) (map[string]string, error) {
+// Parses the command-line arguments, after replacing "@file" arguments with
+// the arguments in the file (see expandArgsFiles()).
+func processCommandLine(params map[string]Param, version string) (map[string]string, error) {
+	arguments, err := expandArgsFiles(os.Args[1:], nil)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return parseArguments(arguments, params, version)
+}
+
+// Matches each argument (e.g. "-port=8080") with the supported params and
+// returns the values by param name.
+func parseArguments(arguments []string, params map[string]Param, version string) (map[string]string, error) {
 	args := make(map[string]string) // local map to hold environmental and command-line key-value pairs
 
-	log.Debugf("Processing command-line arguments: %v", os.Args[1:])
+	log.Debugf("Processing %d command-line arguments...", len(arguments))
 	// Compare each argument with list of supported paramters
-	for i := 1; i <= len(os.Args[1:]); i++ {
-		log.Debugf("--> Process argument: %s", os.Args[i])
+	for _, argument := range arguments {
+		// the value may be sensitive, see the match below
+		log.Debugf("--> Process argument: %s", strings.SplitN(argument, "=", 2)[0])
 		match := false // flag to specify whether argument was found in list of supported paramters
 		for param := range params {
-			kv := strings.Split(os.Args[i], "=") // split the argument into key + value
+			kv := strings.Split(argument, "=") // split the argument into key + value
 			// if there were "=" after the first one, assume they are part of the right-hand value and reconstitute
 			if len(kv) > 2 {
 				for n := len(kv); n > 2; n-- {
@@ -422,47 +663,75 @@ func processCommandLine(params map[string]Param) (map[string]string, error) {
 				prefix = params[param].PrefixOverride // prefix override was specified for this parameter. override default prefix.
 			}
 			arg := strings.TrimPrefix(kv[0], prefix) // strip out the prefix so we can index the map cleanly
-			if param == arg {
+			alias := findAlias(params[param], arg)
+			if param == arg || alias != nil {
+				if alias != nil { // old name; map it onto the param
+					if err := checkAlias(*alias, fmt.Sprintf("Switch '%s'", prefix+alias.Name), fmt.Sprintf("'%s'", prefix+param), version); err != nil {
+						log.Error(err)
+						return nil, err
+					}
+				}
 				// set the kv pair in the args map
 				match = true
-				if len(kv) == 1 { // split resulted in a key but no value (e.g., "--debug")
-					args[arg] = "true" // if value isn't provided, default to true
-				} else {
-					args[arg] = kv[1]
+				value := "true" // if value isn't provided, default to true
+				if len(kv) > 1 {
+					value = kv[1]
 				}
-				log.Debugf("----> Found match: %s = %s", param, args[arg])
+				if previous := args[param]; previous != "" && value != "" && params[param].Type == PARAM_CONFIG_JSON_FILE {
+					value = previous + string(os.PathListSeparator) + value // repeated config file switches add to the list
+				} else if previous != "" && value != "" && (params[param].Type == PARAM_CONFIG_SET || params[param].Type == PARAM_CONFIG_JSON_PATCH) {
+					value = previous + "\n" + value // as are repeated overlays, one per line
+				}
+				args[param] = value
+				log.Debugf("----> Found match: %s = %v", param, redact(params[param].Sensitive, args[param]))
 				break
 			}
 		}
 		if !match {
 			log.Debugf("----> No match.")
-			err := fmt.Errorf("'%s' is not a supported flag.", os.Args[i])
-			log.Errorf(err.Error()) // send to syslog
-			return nil, err         // instead of returning the current config object, let's be more deterministic and return an empty Config struct
+			err := fmt.Errorf("'%s' is not a supported flag.", argument)
+			log.Error(err)  // send to syslog
+			return nil, err // instead of returning the current config object, let's be more deterministic and return an empty Config struct
 		}
 	}
 
-	log.Debugf("--> Done. Command-line arguments overrides: %v", args)
+	log.Debugf("--> Done. Command-line arguments overrides: %v", redactedStrings(params, args))
 
 	return args, nil
 }
 
-func getValsFromEnvVars(params map[string]Param) (map[string]string, error) {
+// Reads the environmental variables named after the params (and their
+// aliases). With a prefix, the names are prefixed, upper-cased and use "_"
+// instead of "-" and "." (e.g. "MYAPP_STATSD_ADDR" for "statsd-addr").
+func getValsFromEnvVars(params map[string]Param, prefix string, version string) (map[string]string, Errors) {
 	envs := make(map[string]string)
+	var errs Errors
 
 	log.Debugf("Checking environmental variables...")
 
-	for param := range params {
-		val := os.Getenv(param)
+	for _, param := range sortedKeys(params) {
+		val := os.Getenv(envVarName(param, prefix))
 		if val != "" {
 			envs[param] = val
-			log.Debugf("----> Found match: %s = %s", param, envs[param])
+			log.Debugf("----> Found match: %s = %v", param, redact(params[param].Sensitive, envs[param]))
+		}
+		for _, alias := range params[param].Aliases {
+			aliasVal := os.Getenv(envVarName(alias.Name, prefix))
+			if aliasVal == "" {
+				continue
+			}
+			if err := checkAlias(alias, fmt.Sprintf("Environmental variable '%s'", envVarName(alias.Name, prefix)), fmt.Sprintf("'%s'", envVarName(param, prefix)), version); err != nil {
+				errs = append(errs, &ParamError{Param: param, Origin: Origin{Source: SOURCE_ENV}, Value: aliasVal, Err: err})
+			} else if val == "" { // the param's own name takes precedence
+				envs[param] = aliasVal
+				log.Debugf("----> Found match for alias %s: %s = %v", alias.Name, param, redact(params[param].Sensitive, envs[param]))
+			}
 		}
 	}
 
-	log.Debugf("--> Done. Environmental variables: %v", envs)
+	log.Debugf("--> Done. Environmental variables: %v", redactedStrings(params, envs))
 
-	return envs, nil
+	return envs, errs
 }
 
 func isCommandLineUsageTypeTrue(args map[string]string, config *Config) (bool, error) {
@@ -487,7 +756,7 @@ func isCommandLineUsageTypeTrue(args map[string]string, config *Config) (bool, e
 }
 
 func GetBoolFromCommandLine(param string, params map[string]Param) bool {
-	args, err := processCommandLine(params)
+	args, err := processCommandLine(params, "")
 	if err != nil {
 		return false
 	}
@@ -501,36 +770,47 @@ func GetBoolFromCommandLine(param string, params map[string]Param) bool {
 	return false
 }
 
-func parseJsonFromFile(f *os.File, configFileName string, configNode string) map[string]interface{} {
-	if f == nil {
-		log.Errorf("Json input from file/stdin was specified, but file descriptor was nil.")
-		os.Exit(1)
+func parseJsonFromFile(r io.Reader, configFileName string, relaxed bool) (map[string]interface{}, map[string]position, error) {
+	if r == nil {
+		return nil, nil, fmt.Errorf("Json input from file/stdin was specified, but file descriptor was nil.")
 	}
 
-	config := make(map[string]interface{})
-
-	jsonParser := json.NewDecoder(f)
-	if err := jsonParser.Decode(&config); err != nil {
-		log.Errorf(err.Error()) // send to syslog
-		os.Exit(1)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
 	}
-	log.Debugf("--> Loaded JSON config file: %v", configFileName)
-
-	// If a configNode is specified, then the config file is expected to have
-	// more info than needed. Set configVals to just the portion we're interested in.
-	if configNode != "" {
-		if (config[configNode] != nil) && (reflect.TypeOf(config[configNode]).String() == "map[string]interface {}") {
-			config = config[configNode].(map[string]interface{}) // safe to assert
-			log.Debugf("--> Filtering JSON based on PARAM_CONFIG_NODE = '%s': %v", configNode, config)
-		} else {
-			err := fmt.Errorf("Node '%s' not found in JSON file '%s'.", configNode, configFileName)
-			log.Errorf(err.Error())
-			os.Exit(1)
+	config, positions, err := parseJsonDocument(data, relaxed)
+	if err != nil {
+		if syntaxErr, ok := err.(*JsonSyntaxError); ok {
+			syntaxErr.File = configFileName
 		}
+		return nil, nil, err
 	}
+	log.Debugf("--> Loaded JSON config file: %v", configFileName)
+
+	return config, positions, nil
+}
 
-	return config
+// Turns a config document read from origin into a layer: if a configNode is
+// specified, then the config file is expected to have more info than needed,
+// so only the selected node(s) are kept.
+func documentLayer(doc configDocument, origin Origin, configNode string, params map[string]Param) (layer, error) {
+	name := origin.File
+	if name == "" {
+		name = origin.String()
+	}
+	vals, from, err := selectConfigNodes(doc.vals, configNode, name, params)
+	if err != nil {
+		return layer{}, err
+	}
 
+	l := layer{origin: origin, origins: make(map[string]Origin), vals: vals}
+	for key, path := range from {
+		if keyOrigin, ok := doc.origins[path]; ok {
+			l.origins[key] = keyOrigin
+		}
+	}
+	return l, nil
 }
 
 func getPreliminaryConfigValue(config Config, args map[string]string, params map[string]Param, configKeyType ParamType) string {
@@ -544,14 +824,128 @@ func getPreliminaryConfigValue(config Config, args map[string]string, params map
 		if str, ok := args[configKey]; ok {
 			configValue = str // string value found in args[] array
 		} else {
-			if (params[configKey].Default != nil) && (reflect.TypeOf(params[configKey].Default).Kind() == reflect.String) { // nothing found in env or cmd-line; check Default value
-				configValue = params[configKey].Default.(string) // safe to assert
+			if def, ok := params[configKey].Default.(string); ok { // nothing found in env or cmd-line; check Default value
+				configValue = def
 			}
 		}
 	}
 	return configValue
 }
 
+// Reports whether the (first) param of the given special type was given on
+// the command-line.
+func isOnCommandLine(config Config, args map[string]string, configKeyType ParamType) bool {
+	keys := config.GetParamKeysByType(configKeyType)
+	if len(keys) == 0 {
+		return false
+	}
+	_, ok := args[keys[0]]
+	return ok
+}
+
+// Converts values that arrived as strings (environmental variables and
+// command-line) or float64 (JSON) to the Go type matching the param Type.
+// Returns an error wrapping ErrConversion when that isn't possible.
+func convertValue(paramType ParamType, value interface{}) (interface{}, error) {
+	switch paramType {
+	case PARAM_BOOL:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: '%s' is not a bool", ErrConversion, v)
+			}
+			return b, nil
+		}
+		return nil, fmt.Errorf("%w: expected a bool, got %s", ErrConversion, reflect.TypeOf(value))
+	case PARAM_INT:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case string:
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: '%s' is not an int", ErrConversion, v)
+			}
+			return i, nil
+		case float64: //when reading from JSON
+			if v != float64(int(v)) {
+				return nil, fmt.Errorf("%w: %v is not an int", ErrConversion, v)
+			}
+			return int(v), nil
+		}
+		return nil, fmt.Errorf("%w: expected an int, got %s", ErrConversion, reflect.TypeOf(value))
+	case PARAM_LIST:
+		switch v := value.(type) {
+		case []interface{}:
+			return v, nil
+		case string:
+			list := []interface{}{}
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			return list, nil
+		}
+		if isList(value) { // e.g. a []string Default
+			rv := reflect.ValueOf(value)
+			list := make([]interface{}, rv.Len())
+			for i := range list {
+				list[i] = rv.Index(i).Interface()
+			}
+			return list, nil
+		}
+		return nil, fmt.Errorf("%w: expected a list, got %s", ErrConversion, reflect.TypeOf(value))
+	case PARAM_PATH:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("%w: expected a path, got %s", ErrConversion, reflect.TypeOf(value))
+	}
+	return value, nil
+}
+
+// Runs the Validate and ValidateErr functions and the Rules of a param (if
+// any) against a value. Returns an error wrapping ErrValidation if the value is
+// rejected. A validator that panics (e.g., on an unexpected type assertion)
+// counts as a rejection instead of crashing the app.
+func validateValue(p Param, value interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: validator panicked: %v", ErrValidation, r)
+		}
+	}()
+	if p.Validate != nil && !p.Validate(value) {
+		return ErrValidation
+	}
+	if p.ValidateErr != nil {
+		if err := p.ValidateErr(value); err != nil {
+			return fmt.Errorf("%w: %v", ErrValidation, err)
+		}
+	}
+	for _, rule := range p.Rules {
+		if err := rule.Check(value); err != nil {
+			return fmt.Errorf("%w: %v", ErrValidation, err)
+		}
+	}
+	return nil
+}
+
+// Converts environmental variables or command-line arguments for use as a
+// layer. Empty strings are treated as not provided.
+func stringVals(strs map[string]string) map[string]interface{} {
+	vals := make(map[string]interface{})
+	for key, str := range strs {
+		if str != "" {
+			vals[key] = str
+		}
+	}
+	return vals
+}
+
 //Pulls all keys out of a map, sorts them, and returns them as an array.
 //This alows stable/sorted iteration over maps
 func sortedKeys(inMap map[string]Param) []string {
@@ -0,0 +1,113 @@
+package appconfig
+
+import "fmt"
+import "sort"
+import "strings"
+
+// A param counts as "set" for the purpose of RequiredIf, ConflictsWith,
+// ExactlyOneOf and AtLeastOneOf when its value was supplied by a config file,
+// stdin, an environmental variable or the command-line; a Default doesn't count.
+func (c *Config) isSet(param string) bool {
+	origin, ok := c.origins[param]
+	return ok && origin.Source != SOURCE_DEFAULT
+}
+
+// Checks the relationships declared between params and returns one
+// *ParamError per violation.
+func checkConstraints(c *Config) Errors {
+	var errs Errors
+	switches := c.GetKeysWithPrefix()
+	seenGroups := make(map[string]bool) // a group may be declared on each of its members; report it once
+
+	for _, param := range sortedKeys(c.params) {
+		p := c.params[param]
+
+		if !c.isSet(param) {
+			for _, other := range p.RequiredIf {
+				if c.isSet(other) && p.Default == nil { // a Default satisfies the requirement
+					errs = append(errs, &ParamError{Param: param, Err: fmt.Errorf("%w: required when '%s' is set", ErrMissing, switches[other])})
+					break
+				}
+			}
+		} else {
+			for _, other := range p.ConflictsWith {
+				if c.isSet(other) {
+					errs = append(errs, &ParamError{Param: param, Origin: c.origins[param], Value: c.values[param], Err: fmt.Errorf("%w: cannot be used together with '%s'", ErrConstraint, switches[other])})
+				}
+			}
+		}
+
+		for _, group := range []struct {
+			members []string
+			exactly bool
+		}{{p.ExactlyOneOf, true}, {p.AtLeastOneOf, false}} {
+			if len(group.members) == 0 {
+				continue
+			}
+			members := groupMembers(param, group.members)
+			key := fmt.Sprintf("%v:%s", group.exactly, strings.Join(members, ","))
+			if seenGroups[key] {
+				continue
+			}
+			seenGroups[key] = true
+
+			count := 0
+			for _, member := range members {
+				if c.isSet(member) {
+					count++
+				}
+			}
+			if count == 0 || (group.exactly && count > 1) {
+				which := "at least one"
+				if group.exactly {
+					which = "exactly one"
+				}
+				errs = append(errs, &ParamError{Param: param, Err: fmt.Errorf("%w: %s of %s must be set (%d set)", ErrConstraint, which, joinSwitches(members, switches), count)})
+			}
+		}
+	}
+	return errs
+}
+
+// Returns the sorted, de-duplicated members of a group declared on a param,
+// including the param itself.
+func groupMembers(param string, others []string) []string {
+	unique := map[string]bool{param: true}
+	for _, other := range others {
+		unique[other] = true
+	}
+	members := make([]string, 0, len(unique))
+	for member := range unique {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func joinSwitches(params []string, switches map[string]string) string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = "'" + switches[param] + "'"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Describes the constraints of a param for PrintUsage().
+func (c *Config) constraintUsage(param string) []string {
+	var lines []string
+	p := c.params[param]
+	switches := c.GetKeysWithPrefix()
+	if len(p.RequiredIf) > 0 {
+		lines = append(lines, fmt.Sprintf("(required if any of: %s)", joinSwitches(p.RequiredIf, switches)))
+	}
+	if len(p.ConflictsWith) > 0 {
+		lines = append(lines, fmt.Sprintf("(conflicts with: %s)", joinSwitches(p.ConflictsWith, switches)))
+	}
+	if len(p.ExactlyOneOf) > 0 {
+		lines = append(lines, fmt.Sprintf("(exactly one of: %s)", joinSwitches(groupMembers(param, p.ExactlyOneOf), switches)))
+	}
+	if len(p.AtLeastOneOf) > 0 {
+		lines = append(lines, fmt.Sprintf("(at least one of: %s)", joinSwitches(groupMembers(param, p.AtLeastOneOf), switches)))
+	}
+	return lines
+}
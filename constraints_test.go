@@ -0,0 +1,40 @@
+package appconfig
+
+import "errors"
+import "fmt"
+import "os"
+import "testing"
+
+func TestCheckConstraintsRequiredIf(t *testing.T) {
+	params := map[string]Param{
+		"tls":      {Type: PARAM_BOOL},
+		"tls-cert": {RequiredIf: []string{"tls"}},
+		"tls-port": {Type: PARAM_INT, Default: 443, RequiredIf: []string{"tls"}},
+	}
+	config := &Config{
+		params:  params,
+		values:  map[string]interface{}{"tls": true, "tls-port": 443},
+		origins: map[string]Origin{"tls": {Source: SOURCE_ARGS}, "tls-port": {Source: SOURCE_DEFAULT}},
+	}
+	errs := checkConstraints(config)
+	if len(errs) != 1 {
+		t.Fatalf("got %v, want only tls-cert missing", errs)
+	}
+	var paramErr *ParamError
+	if !errors.As(errs[0], &paramErr) || paramErr.Param != "tls-cert" || !errors.Is(errs[0], ErrMissing) {
+		t.Errorf("got %v, want tls-cert missing", errs[0])
+	}
+}
+
+func TestValidateOptionWrappedErrors(t *testing.T) {
+	args := os.Args
+	os.Args = []string{"app"}
+	defer func() { os.Args = args }()
+	first, second := errors.New("first"), errors.New("second")
+	validate := func(*Config) error { return fmt.Errorf("checking: %w", Errors{first, second}) }
+	_, err := NewConfigWithOptions(map[string]Param{"port": {Type: PARAM_INT}}, Options{Validate: validate})
+	all, ok := err.(Errors)
+	if !ok || len(all) != 2 || all[0] != first || all[1] != second {
+		t.Errorf("got %#v, want the wrapped Errors flattened", err)
+	}
+}
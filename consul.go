@@ -0,0 +1,210 @@
+package appconfig
+
+import "context"
+import "encoding/base64"
+import "encoding/json"
+import "fmt"
+import "net/http"
+import "net/url"
+import "os"
+import "strconv"
+import "strings"
+import "sync"
+import "time"
+
+import log "github.com/sirupsen/logrus"
+
+// Name of the ConsulSource, as used in Origin.Source.
+const SOURCE_CONSUL = "consul"
+
+// ConsulSource is a Source that reads the keys under a prefix of Consul's KV
+// store through its HTTP API. The first part of a key below the prefix names
+// a param and further parts are paths inside an object param, so with Prefix
+// "myapp/config", the key "myapp/config/ProxyRules/api/ScriptFile" sets
+// ProxyRules["api"]["ScriptFile"]. Values are strings, converted to the
+// param's Type as for environmental variables.
+//
+// Watch() uses blocking queries, so changes are noticed as soon as Consul
+// reports a new index for the prefix.
+type ConsulSource struct {
+	Address      string        // Base URL of the Consul agent. Default is $CONSUL_HTTP_ADDR, or else "http://127.0.0.1:8500".
+	AddressParam string        // Name of a param holding the address, used if Address is empty.
+	Prefix       string        // Key prefix, e.g. "myapp/config".
+	Datacenter   string        // Datacenter to query. Default is the agent's.
+	Token        string        // ACL token. Default is $CONSUL_HTTP_TOKEN.
+	TokenParam   string        // Name of a param holding the ACL token (e.g. "consul-token"), used if Token is empty.
+	Nodes        bool          // The first part of a key below the prefix is a config node (e.g. "proxy/port"), from which PARAM_CONFIG_NODE selects as for config files.
+	Timeout      time.Duration // Timeout of reading the prefix. Default is 10 seconds.
+	WaitTime     time.Duration // How long each blocking query of Watch() waits for a change. Default is 5 minutes.
+	Client       *http.Client  // Client to use instead of http.DefaultClient with the timeouts above.
+
+	mu      sync.Mutex
+	address string // the address and token last loaded with, for Watch()
+	token   string
+	index   uint64 // X-Consul-Index of the last read
+}
+
+// An entry of Consul's /v1/kv response.
+type consulKV struct {
+	Key   string
+	Value *string // base64, null for folders
+}
+
+func (s *ConsulSource) Name() string {
+	return SOURCE_CONSUL
+}
+
+func (s *ConsulSource) Load(ctx context.Context) (*Tree, error) {
+	address := s.Address
+	if address == "" {
+		address = lookupString(ctx, s.AddressParam)
+	}
+	if address == "" {
+		address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if address == "" {
+		address = "http://127.0.0.1:8500"
+	}
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	token := s.Token
+	if token == "" {
+		token = lookupString(ctx, s.TokenParam)
+	}
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+
+	s.mu.Lock()
+	s.address, s.token = address, token
+	s.mu.Unlock()
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	kvs, index, err := s.read(ctx, address, token, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.index = index
+	s.mu.Unlock()
+
+	prefix := strings.Trim(s.Prefix, "/")
+	tree := &Tree{Values: make(map[string]interface{}), Origin: Origin{Source: SOURCE_CONSUL, File: prefix}, Origins: make(map[string]Origin), Document: s.Nodes}
+	for _, kv := range kvs {
+		keys := splitStoreKey(kv.Key, prefix)
+		if kv.Value == nil || len(keys) == 0 {
+			continue // folder
+		}
+		value, err := base64.StdEncoding.DecodeString(*kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value of Consul key '%s': %v.", kv.Key, err)
+		}
+		setTreePath(tree, keys, string(value), Origin{Source: SOURCE_CONSUL, File: kv.Key})
+	}
+	log.Debugf("--> Read %d keys under '%s' from Consul at index %d", len(kvs), prefix, index)
+	return tree, nil
+}
+
+// Watch waits for the index of the prefix to change with blocking queries
+// and calls changed() when it does. Failed queries are logged and retried.
+func (s *ConsulSource) Watch(ctx context.Context, changed func()) error {
+	wait := s.WaitTime
+	if wait <= 0 {
+		wait = 5 * time.Minute
+	}
+	for ctx.Err() == nil {
+		s.mu.Lock()
+		address, token, index := s.address, s.token, s.index
+		s.mu.Unlock()
+
+		// Consul adds up to wait/16 of jitter to the wait
+		queryCtx, cancel := context.WithTimeout(ctx, wait+wait/16+10*time.Second)
+		_, newIndex, err := s.read(queryCtx, address, token, index, "wait="+strconv.Itoa(int(wait/time.Second))+"s")
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.WithFields(log.Fields{"err": err}).Warnf("Cannot watch Consul prefix '%s', retrying.", s.Prefix)
+				sleepContext(ctx, 5*time.Second)
+			}
+			continue
+		}
+
+		if newIndex == 0 { // not a blocking query after all; don't spin
+			sleepContext(ctx, 5*time.Second)
+		}
+
+		s.mu.Lock()
+		if newIndex < s.index { // the index went backwards (e.g. a snapshot restore), start over
+			newIndex = 0
+		}
+		updated := index != 0 && newIndex != s.index
+		s.index = newIndex
+		s.mu.Unlock()
+		if updated {
+			log.Infof("Consul prefix '%s' has changed.", s.Prefix)
+			changed()
+		}
+	}
+	return nil
+}
+
+// Reads all keys under the prefix. A non-zero index makes it a blocking
+// query that returns when the prefix changes after that index.
+func (s *ConsulSource) read(ctx context.Context, address string, token string, index uint64, query ...string) ([]consulKV, uint64, error) {
+	u := strings.TrimRight(address, "/") + "/v1/kv/" + escapeKey(strings.Trim(s.Prefix, "/")) + "?recurse=true"
+	if s.Datacenter != "" {
+		u += "&dc=" + url.QueryEscape(s.Datacenter)
+	}
+	if index > 0 {
+		u += "&index=" + strconv.FormatUint(index, 10)
+	}
+	for _, q := range query {
+		u += "&" + q
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch resp.StatusCode {
+	case http.StatusNotFound: // no keys under the prefix
+		return nil, newIndex, nil
+	case http.StatusOK:
+	default:
+		return nil, 0, fmt.Errorf("Cannot read Consul prefix '%s': %s.", s.Prefix, resp.Status)
+	}
+	var kvs []consulKV
+	if err := json.NewDecoder(resp.Body).Decode(&kvs); err != nil {
+		return nil, 0, fmt.Errorf("Invalid response for Consul prefix '%s': %v.", s.Prefix, err)
+	}
+	return kvs, newIndex, nil
+}
+
+// Escapes each "/"-separated part of a key for use in a URL path.
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,134 @@
+package appconfig
+
+import "context"
+import "encoding/base64"
+import "fmt"
+import "net/http"
+import "net/http/httptest"
+import "reflect"
+import "strconv"
+import "sync"
+import "sync/atomic"
+import "testing"
+import "time"
+
+// A Consul agent with one prefix whose X-Consul-Index is advanced by the
+// test. Blocking queries return at once (as if their wait time had passed)
+// with the current index.
+type testConsulServer struct {
+	mu       sync.Mutex
+	index    uint64
+	blocking []string // index of each blocking query
+}
+
+func (s *testConsulServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != "secret" {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+	if r.URL.Path != "/v1/kv/myapp/config" || r.URL.Query().Get("recurse") != "true" {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	if index := r.URL.Query().Get("index"); index != "" {
+		s.blocking = append(s.blocking, index)
+	}
+	index := s.index
+	s.mu.Unlock()
+
+	encode := func(value string) string { return base64.StdEncoding.EncodeToString([]byte(value)) }
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+	fmt.Fprintf(w, `[
+		{"Key": "myapp/config/", "Value": null},
+		{"Key": "myapp/config/port", "Value": "%s"},
+		{"Key": "myapp/config/ProxyRules/api/ScriptFile", "Value": "%s"},
+		{"Key": "other/port", "Value": "%s"}
+	]`, encode(strconv.FormatUint(index, 10)), encode("api.js"), encode("1"))
+}
+
+func (s *testConsulServer) setIndex(index uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index = index
+}
+
+func TestConsulSourceLoad(t *testing.T) {
+	server := &testConsulServer{index: 7}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	source := &ConsulSource{Address: ts.URL, Prefix: "/myapp/config/", Token: "secret"}
+	tree, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"port":       "7",
+		"ProxyRules": map[string]interface{}{"api": map[string]interface{}{"ScriptFile": "api.js"}},
+	}
+	if !reflect.DeepEqual(tree.Values, want) {
+		t.Errorf("got %v, want %v", tree.Values, want)
+	}
+	if origin := tree.Origins[docPath("ProxyRules", "api", "ScriptFile")]; origin.File != "myapp/config/ProxyRules/api/ScriptFile" {
+		t.Errorf("got origin %v", origin)
+	}
+	if source.index != 7 {
+		t.Errorf("got index %d, want 7", source.index)
+	}
+
+	if _, err := (&ConsulSource{Address: ts.URL, Prefix: "myapp/config", Token: "wrong"}).Load(context.Background()); err == nil {
+		t.Error("no error with a wrong token")
+	}
+}
+
+func TestConsulSourceWatchIndex(t *testing.T) {
+	server := &testConsulServer{index: 7}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	source := &ConsulSource{Address: ts.URL, Prefix: "myapp/config", Token: "secret", WaitTime: time.Second}
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var changes int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		source.Watch(ctx, func() {
+			switch atomic.AddInt32(&changes, 1) {
+			case 1:
+				server.setIndex(3) // goes backwards, e.g. after a snapshot restore
+			default:
+				cancel()
+			}
+		})
+	}()
+
+	// Queries returning the same index are not changes
+	for {
+		server.mu.Lock()
+		queries := len(server.blocking)
+		server.mu.Unlock()
+		if queries >= 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&changes); n != 0 {
+		t.Fatalf("got %d changes while the index stayed the same", n)
+	}
+	server.setIndex(8)
+	<-done
+	if ctx.Err() != context.Canceled {
+		t.Fatalf("got %v, want a change for the new index and one for the index going backwards", ctx.Err())
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if first, last := server.blocking[0], server.blocking[len(server.blocking)-1]; first != "7" || last != "8" {
+		t.Errorf("blocking queries at indexes %v, want from 7 up to 8", server.blocking)
+	}
+}
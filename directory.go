@@ -0,0 +1,151 @@
+package appconfig
+
+import "context"
+import "fmt"
+import "os"
+import "path/filepath"
+import "sort"
+import "strings"
+import "sync"
+import "time"
+
+import log "github.com/sirupsen/logrus"
+
+// Name of the DirSource, as used in Origin.Source.
+const SOURCE_DIR = "directory"
+
+// Name of the symlink through which Kubernetes swaps the contents of mounted
+// ConfigMaps and Secrets atomically.
+const kubernetesDataLink = "..data"
+
+// DirSource is a Source that reads a directory with one file per param, such
+// as a Kubernetes ConfigMap or Secret volume: the file name is the param name
+// and the content its value. A single trailing newline is removed, content
+// holding a JSON object or array is decoded, and anything else is a string
+// that is converted to the param's Type as for environmental variables.
+// Hidden files (including Kubernetes' "..data" link and the timestamped
+// directories behind it) and subdirectories are skipped.
+//
+// Watch() notices when Kubernetes swaps the "..data" link to a new version of
+// the volume, or, in any other directory, when a file is added, removed or
+// modified.
+type DirSource struct {
+	Dir          string        // The directory, e.g. "/etc/myapp/config".
+	DirParam     string        // Name of a param holding the directory, used if Dir is empty.
+	Sensitive    bool          // The values are secrets, e.g. for a mounted Secret (see Param.Sensitive).
+	PollInterval time.Duration // How often Watch() checks for changes. Default is 10 seconds.
+
+	mu      sync.Mutex
+	dir     string // the directory last loaded, for Watch()
+	version string // "..data" target or file listing of the last load
+}
+
+func (s *DirSource) Name() string {
+	return SOURCE_DIR
+}
+
+func (s *DirSource) Load(ctx context.Context) (*Tree, error) {
+	dir := s.Dir
+	if dir == "" {
+		dir = lookupString(ctx, s.DirParam)
+	}
+	if dir == "" {
+		log.Debugf("No directory for the directory source.")
+		return nil, nil
+	}
+
+	version, err := dirVersion(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	tree := &Tree{Values: make(map[string]interface{}), Origin: Origin{Source: SOURCE_DIR, File: dir}, Origins: make(map[string]Origin), Sensitive: s.Sensitive}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(file) // follows the per-key symlinks into "..data"
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		content = []byte(strings.TrimSuffix(strings.TrimSuffix(string(content), "\n"), "\r"))
+		tree.Values[entry.Name()] = decodeStoreValue(content)
+		tree.Origins[docPath(entry.Name())] = Origin{Source: SOURCE_DIR, File: file}
+	}
+
+	s.mu.Lock()
+	s.dir, s.version = dir, version
+	s.mu.Unlock()
+	log.Debugf("--> Read %d files from directory '%s'", len(tree.Values), dir)
+	return tree, nil
+}
+
+// Watch checks the directory every PollInterval and calls changed() when its
+// version differs from the one last loaded.
+func (s *DirSource) Watch(ctx context.Context, changed func()) error {
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		dir, version := s.dir, s.version
+		s.mu.Unlock()
+		if dir == "" {
+			continue
+		}
+		current, err := dirVersion(dir)
+		if err != nil {
+			log.WithFields(log.Fields{"err": err}).Warnf("Cannot check directory '%s'.", dir)
+			continue
+		}
+		if current != version {
+			s.mu.Lock()
+			s.version = current
+			s.mu.Unlock()
+			log.Infof("Directory '%s' has changed.", dir)
+			changed()
+		}
+	}
+}
+
+// Identifies the contents of a directory: the target of the Kubernetes
+// "..data" link if there is one, or else the names, sizes and modification
+// times of its files.
+func dirVersion(dir string) (string, error) {
+	if target, err := os.Readlink(filepath.Join(dir, kubernetesDataLink)); err == nil {
+		return target, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var files []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, fmt.Sprintf("%s:%d:%d", entry.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+	sort.Strings(files)
+	return strings.Join(files, "\n"), nil
+}
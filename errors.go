@@ -0,0 +1,71 @@
+package appconfig
+
+import "errors"
+import "fmt"
+import "strings"
+
+// Errors collects every problem found in one pass so they can be reported
+// together instead of one per run. Unwrap exposes the individual errors to
+// errors.Is and errors.As.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the collected errors (errors.Join-style).
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// DefinitionError describes a mistake in a Param definition itself, as opposed
+// to a problem with the value supplied for it. See ValidateParams().
+type DefinitionError struct {
+	Param  string // key of the offending param in the params map
+	Reason string
+}
+
+func (e *DefinitionError) Error() string {
+	return fmt.Sprintf("Invalid definition of param '%s': %s.", e.Param, e.Reason)
+}
+
+// These errors are wrapped by ParamError.Err, so callers can tell the kinds of
+// problems apart with errors.Is.
+var (
+	ErrMissing       = errors.New("missing required parameter")
+	ErrConversion    = errors.New("cannot convert value")
+	ErrValidation    = errors.New("validation failed")
+	ErrConstraint    = errors.New("constraint violated")
+	ErrRemoved       = errors.New("name no longer supported")
+	ErrInterpolation = errors.New("cannot interpolate value")
+	ErrUnknown       = errors.New("unknown parameter")
+	ErrSource        = errors.New("value not allowed from this source")
+)
+
+// ParamError describes a problem with the value of a single parameter:
+// a required value that is missing, a value that can't be converted to the
+// param Type, or a value rejected by a validator.
+type ParamError struct {
+	Param  string      // key of the param in the params map
+	Origin Origin      // where the value came from; Origin.Source is empty if there is no value
+	Value  interface{} // the offending value, if any
+	Err    error       // wraps one of the Err* errors above
+}
+
+func (e *ParamError) Error() string {
+	msg := fmt.Sprintf("Param '%s'", e.Param)
+	if e.Origin.Source != "" && e.Value == nil {
+		msg += fmt.Sprintf(" (from %s)", e.Origin)
+	} else if e.Origin.Source != "" {
+		msg += fmt.Sprintf(" (value %v from %s)", e.Value, e.Origin)
+	}
+	return msg + ": " + e.Err.Error() + "."
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,277 @@
+package appconfig
+
+import "bytes"
+import "context"
+import "encoding/base64"
+import "encoding/json"
+import "fmt"
+import "io"
+import "net/http"
+import "strconv"
+import "strings"
+import "sync"
+import "time"
+
+import log "github.com/sirupsen/logrus"
+
+// Name of the EtcdSource, as used in Origin.Source.
+const SOURCE_ETCD = "etcd"
+
+// EtcdSource is a Source that reads the keys under a prefix from etcd through
+// its v3 JSON gateway (/v3/kv/range). As for ConsulSource, the first part of
+// a key below the prefix names a param and further parts are paths inside an
+// object param. Values holding a JSON object or array are decoded; any other
+// value is a string, converted to the param's Type as for environmental
+// variables.
+//
+// Watch() keeps a watch stream (/v3/watch) open from the revision that was
+// read, reconnecting when it breaks.
+type EtcdSource struct {
+	Endpoint      string        // Base URL of an etcd member. Default is "http://127.0.0.1:2379".
+	EndpointParam string        // Name of a param holding the endpoint, used if Endpoint is empty.
+	Prefix        string        // Key prefix, e.g. "/myapp/config".
+	Username      string        // User to authenticate as, if etcd has authentication enabled.
+	UsernameParam string        // Name of a param holding the user, used if Username is empty.
+	Password      string        // Password of the user.
+	PasswordParam string        // Name of a param holding the password (e.g. "etcd-password"), used if Password is empty.
+	Nodes         bool          // The first part of a key below the prefix is a config node, from which PARAM_CONFIG_NODE selects as for config files.
+	Timeout       time.Duration // Timeout of reading the prefix. Default is 10 seconds.
+	Client        *http.Client  // Client to use instead of http.DefaultClient.
+
+	mu       sync.Mutex
+	endpoint string // the endpoint and credentials last loaded with, for Watch()
+	username string
+	password string
+	revision int64 // revision of the last read
+}
+
+// Responses of the JSON gateway. 64-bit integers are encoded as strings.
+type etcdHeader struct {
+	Revision string `json:"revision"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader `json:"header"`
+	Kvs    []struct {
+		Key   string `json:"key"`   // base64
+		Value string `json:"value"` // base64
+	} `json:"kvs"`
+}
+
+type etcdWatchResponse struct {
+	Result *struct {
+		Header   etcdHeader        `json:"header"`
+		Created  bool              `json:"created"`
+		Canceled bool              `json:"canceled"`
+		Events   []json.RawMessage `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (s *EtcdSource) Name() string {
+	return SOURCE_ETCD
+}
+
+func (s *EtcdSource) Load(ctx context.Context) (*Tree, error) {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = lookupString(ctx, s.EndpointParam)
+	}
+	if endpoint == "" {
+		endpoint = "http://127.0.0.1:2379"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	username := s.Username
+	if username == "" {
+		username = lookupString(ctx, s.UsernameParam)
+	}
+	password := s.Password
+	if password == "" {
+		password = lookupString(ctx, s.PasswordParam)
+	}
+	s.mu.Lock()
+	s.endpoint, s.username, s.password = endpoint, username, password
+	s.mu.Unlock()
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	token, err := s.authenticate(ctx, endpoint, username, password)
+	if err != nil {
+		return nil, err
+	}
+	key, rangeEnd := etcdPrefixRange(s.Prefix)
+	var resp etcdRangeResponse
+	if err := s.post(ctx, endpoint, "/v3/kv/range", token, map[string]string{"key": key, "range_end": rangeEnd}, &resp); err != nil {
+		return nil, fmt.Errorf("Cannot read etcd prefix '%s': %v", s.Prefix, err)
+	}
+	revision, _ := strconv.ParseInt(resp.Header.Revision, 10, 64)
+	s.mu.Lock()
+	s.revision = revision
+	s.mu.Unlock()
+
+	prefix := strings.Trim(s.Prefix, "/")
+	tree := &Tree{Values: make(map[string]interface{}), Origin: Origin{Source: SOURCE_ETCD, File: s.Prefix}, Origins: make(map[string]Origin), Document: s.Nodes}
+	for _, kv := range resp.Kvs {
+		rawKey, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid etcd key '%s': %v.", kv.Key, err)
+		}
+		rawValue, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value of etcd key '%s': %v.", rawKey, err)
+		}
+		keys := splitStoreKey(string(rawKey), prefix)
+		if len(keys) == 0 {
+			continue
+		}
+		setTreePath(tree, keys, decodeStoreValue(rawValue), Origin{Source: SOURCE_ETCD, File: string(rawKey)})
+	}
+	log.Debugf("--> Read %d keys under '%s' from etcd at revision %d", len(resp.Kvs), s.Prefix, revision)
+	return tree, nil
+}
+
+// Watch watches the prefix from the revision after the one read, and calls
+// changed() for every batch of events. A broken stream is logged and
+// reopened.
+func (s *EtcdSource) Watch(ctx context.Context, changed func()) error {
+	for ctx.Err() == nil {
+		if err := s.watch(ctx, changed); err != nil && ctx.Err() == nil {
+			log.WithFields(log.Fields{"err": err}).Warnf("Cannot watch etcd prefix '%s', retrying.", s.Prefix)
+			sleepContext(ctx, 5*time.Second)
+		}
+	}
+	return nil
+}
+
+func (s *EtcdSource) watch(ctx context.Context, changed func()) error {
+	s.mu.Lock()
+	endpoint, username, password, revision := s.endpoint, s.username, s.password, s.revision
+	s.mu.Unlock()
+
+	token, err := s.authenticate(ctx, endpoint, username, password)
+	if err != nil {
+		return err
+	}
+	key, rangeEnd := etcdPrefixRange(s.Prefix)
+	create := map[string]interface{}{"key": key, "range_end": rangeEnd}
+	if revision > 0 {
+		create["start_revision"] = strconv.FormatInt(revision+1, 10)
+	}
+	body, err := s.request(ctx, endpoint, "/v3/watch", token, map[string]interface{}{"create_request": create})
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	decoder := json.NewDecoder(body)
+	for {
+		var resp etcdWatchResponse
+		if err := decoder.Decode(&resp); err != nil {
+			return err
+		}
+		if resp.Error != nil {
+			return fmt.Errorf("%s", resp.Error.Message)
+		}
+		if resp.Result == nil {
+			continue
+		}
+		if resp.Result.Canceled {
+			return fmt.Errorf("Watch of etcd prefix '%s' was canceled.", s.Prefix)
+		}
+		if len(resp.Result.Events) == 0 {
+			continue
+		}
+		if revision, err := strconv.ParseInt(resp.Result.Header.Revision, 10, 64); err == nil {
+			s.mu.Lock()
+			s.revision = revision
+			s.mu.Unlock()
+		}
+		log.Infof("etcd prefix '%s' has changed.", s.Prefix)
+		changed()
+	}
+}
+
+// Returns an auth token for the user, or "" if there is no user.
+func (s *EtcdSource) authenticate(ctx context.Context, endpoint string, username string, password string) (string, error) {
+	if username == "" {
+		return "", nil
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := s.post(ctx, endpoint, "/v3/auth/authenticate", "", map[string]string{"name": username, "password": password}, &resp); err != nil {
+		return "", fmt.Errorf("Cannot authenticate with etcd as '%s': %v", username, err)
+	}
+	return resp.Token, nil
+}
+
+// Posts a JSON request to the gateway and decodes the JSON response.
+func (s *EtcdSource) post(ctx context.Context, endpoint string, path string, token string, request interface{}, response interface{}) error {
+	body, err := s.request(ctx, endpoint, path, token, request)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return json.NewDecoder(body).Decode(response)
+}
+
+// Posts a JSON request to the gateway and returns the response body.
+func (s *EtcdSource) request(ctx context.Context, endpoint string, path string, token string, request interface{}) (io.ReadCloser, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp.Body, nil
+}
+
+// Returns the base64 key and range_end that select every key under a prefix.
+func etcdPrefixRange(prefix string) (string, string) {
+	key := []byte(prefix)
+	if len(key) > 0 && key[len(key)-1] != '/' {
+		key = append(key, '/')
+	}
+	end := append([]byte{}, key...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			end = end[:i+1]
+			break
+		}
+		if i == 0 {
+			end = []byte{0} // every key
+		}
+	}
+	if len(key) == 0 {
+		key, end = []byte{0}, []byte{0}
+	}
+	return base64.StdEncoding.EncodeToString(key), base64.StdEncoding.EncodeToString(end)
+}
@@ -0,0 +1,133 @@
+package appconfig
+
+import "context"
+import "encoding/base64"
+import "encoding/json"
+import "fmt"
+import "net/http"
+import "net/http/httptest"
+import "reflect"
+import "testing"
+import "time"
+
+// A fake etcd v3 JSON gateway with authentication enabled.
+type testEtcdGateway struct {
+	t          *testing.T
+	watchStart chan string // start_revision of each watch
+}
+
+func (g *testEtcdGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Path == "/v3/auth/authenticate" {
+		if request["name"] != "app" || request["password"] != "pw" {
+			http.Error(w, `{"error": "authentication failed"}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"header": {"revision": "1"}, "token": "tok"}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "tok" {
+		http.Error(w, `{"error": "invalid auth token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		if request["key"] != encode("/myapp/") || request["range_end"] != encode("/myapp0") {
+			g.t.Errorf("got range %v", request)
+		}
+		fmt.Fprintf(w, `{"header": {"revision": "42"}, "kvs": [
+			{"key": "%s", "value": "%s"},
+			{"key": "%s", "value": "%s"}
+		], "count": "2"}`,
+			encode("/myapp/port"), encode("8080"),
+			encode("/myapp/ProxyRules"), encode(`{"api": {"ScriptFile": "api.js"}}`))
+	case "/v3/watch":
+		create, _ := request["create_request"].(map[string]interface{})
+		start, _ := create["start_revision"].(string)
+		g.watchStart <- start
+		flusher := w.(http.Flusher)
+		fmt.Fprint(w, `{"result": {"header": {"revision": "42"}, "created": true}}`+"\n")
+		flusher.Flush()
+		fmt.Fprintf(w, `{"result": {"header": {"revision": "44"}, "events": [{"kv": {"key": "%s"}}]}}`+"\n", encode("/myapp/port"))
+		flusher.Flush()
+		<-r.Context().Done()
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestEtcdSourceLoad(t *testing.T) {
+	ts := httptest.NewServer(&testEtcdGateway{t: t})
+	defer ts.Close()
+
+	source := &EtcdSource{Endpoint: ts.URL, Prefix: "/myapp", Username: "app", Password: "pw"}
+	tree, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"port":       "8080",
+		"ProxyRules": map[string]interface{}{"api": map[string]interface{}{"ScriptFile": "api.js"}},
+	}
+	if !reflect.DeepEqual(tree.Values, want) {
+		t.Errorf("got %v, want %v", tree.Values, want)
+	}
+	if source.revision != 42 {
+		t.Errorf("got revision %d, want 42", source.revision)
+	}
+
+	if _, err := (&EtcdSource{Endpoint: ts.URL, Prefix: "/myapp", Username: "app", Password: "wrong"}).Load(context.Background()); err == nil {
+		t.Error("no error with a wrong password")
+	}
+}
+
+func TestEtcdSourceWatch(t *testing.T) {
+	gateway := &testEtcdGateway{t: t, watchStart: make(chan string, 1)}
+	ts := httptest.NewServer(gateway)
+	defer ts.Close()
+	source := &EtcdSource{Endpoint: ts.URL, Prefix: "/myapp", Username: "app", Password: "pw"}
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	source.Watch(ctx, cancel) // returns once the first change has been reported
+	if ctx.Err() != context.Canceled {
+		t.Fatal("no change reported")
+	}
+	if start := <-gateway.watchStart; start != "43" {
+		t.Errorf("watch started at revision %s, want the one after the revision read", start)
+	}
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	if source.revision != 44 {
+		t.Errorf("got revision %d, want 44 from the watch response", source.revision)
+	}
+}
+
+func TestEtcdPrefixRange(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		key, end string
+	}{
+		{"/myapp", "/myapp/", "/myapp0"},
+		{"/myapp/", "/myapp/", "/myapp0"},
+		{"a\xff", "a\xff/", "a\xff0"},
+		{"", "\x00", "\x00"},
+	}
+	for _, test := range tests {
+		key, end := etcdPrefixRange(test.prefix)
+		decodedKey, _ := base64.StdEncoding.DecodeString(key)
+		decodedEnd, _ := base64.StdEncoding.DecodeString(end)
+		if string(decodedKey) != test.key || string(decodedEnd) != test.end {
+			t.Errorf("%q: got %q, %q, want %q, %q", test.prefix, decodedKey, decodedEnd, test.key, test.end)
+		}
+	}
+}
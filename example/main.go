@@ -16,13 +16,9 @@ func main() {
 	params["config-node"] = appconfig.Param{Type: appconfig.PARAM_CONFIG_NODE, Default: "example", Usage: "root node in the config file.", Required: false}
 	params["config-env"] = appconfig.Param{Type: appconfig.PARAM_CONFIG_READ_ENV, Default: false, Usage: "Whether or not to read config from environment variables", Required: false}
 	params["debug"] = appconfig.Param{Type: appconfig.PARAM_BOOL, Default: false, Usage: "verbose output.", PrefixOverride: "--"}
-	params["port"] = appconfig.Param{Type: appconfig.PARAM_STRING, Default: ":8080", Usage: "bind-to port.", Required: true}
-	params["statsd_addr"] = appconfig.Param{Type: appconfig.PARAM_STRING, Usage: "statsd endpoint."}
-	params["timeout"] = appconfig.Param{Type: appconfig.PARAM_INT, Usage: "server timeout 100 <= timeout <= 1000 (ms).", Default: 1000, Validate: func(timeout interface{}) bool {
-		timeoutInt := timeout.(int)
-		return 100 <= timeoutInt && timeoutInt <= 1000
-	},
-	}
+	params["port"] = appconfig.Param{Type: appconfig.PARAM_STRING, Default: ":8080", Usage: "bind-to port."}
+	params["statsd_addr"] = appconfig.Param{Type: appconfig.PARAM_STRING, Usage: "statsd endpoint.", Rules: []appconfig.Rule{appconfig.HostPort()}}
+	params["timeout"] = appconfig.Param{Type: appconfig.PARAM_INT, Usage: "server timeout (ms).", Default: 1000, Rules: []appconfig.Rule{appconfig.IntRange(100, 1000)}}
 	params["help"] = appconfig.Param{Type: appconfig.PARAM_USAGE, Default: false, Usage: "print usage.", Required: false, PrefixOverride: "--"}
 
 	fmt.Printf("\nThe following parameters have been defined:")
@@ -59,7 +55,7 @@ func main() {
 	if json, err := config.ToJson(); err != nil {
 		fmt.Printf("An Error occurred while serializing config to json: %v\n", err)
 	} else {
-		fmt.Printf(json)
+		fmt.Print(json)
 		fmt.Println()
 	}
 
@@ -0,0 +1,134 @@
+package appconfig
+
+import "bytes"
+import "context"
+import "fmt"
+import "os/exec"
+import "sort"
+import "strings"
+import "sync"
+import "time"
+
+import log "github.com/sirupsen/logrus"
+
+// Name of the ExecSource, as used in Origin.Source.
+const SOURCE_EXEC = "exec"
+
+// ExecSource is a Source that runs a helper command per param and uses its
+// standard output as the value, like git's credential helpers, e.g.
+//
+//   &appconfig.ExecSource{Commands: map[string][]string{
+//       "db-password": {"pass", "show", "db"},
+//   }}
+//
+// A trailing newline is removed, and output holding a JSON object or array
+// is decoded, for PARAM_OBJECT and PARAM_LIST params. The commands are run
+// directly, not through a shell. Their output is treated as sensitive (see
+// Param.Sensitive), so it is never logged.
+//
+// Results are cached, so reloads (see Config.Watch()) don't run the commands
+// again until CacheTTL has passed.
+type ExecSource struct {
+	Commands map[string][]string // The command and its arguments, by param name.
+	Dir      string              // Working directory of the commands. Default is the current directory.
+	Env      []string            // Environment of the commands, as "KEY=value". Default is the environment of the app.
+	Timeout  time.Duration       // Timeout of each command. Default is 10 seconds.
+	CacheTTL time.Duration       // How long results are reused. Default (zero) is for the life of the ExecSource.
+
+	mu    sync.Mutex
+	cache map[string]execResult
+}
+
+// How long a command that timed out may take to close its output, see
+// exec.Cmd.WaitDelay.
+const execWaitDelay = 500 * time.Millisecond
+
+type execResult struct {
+	value interface{}
+	at    time.Time
+}
+
+func (s *ExecSource) Name() string {
+	return SOURCE_EXEC
+}
+
+func (s *ExecSource) Load(ctx context.Context) (*Tree, error) {
+	tree := &Tree{Values: make(map[string]interface{}), Origin: Origin{Source: SOURCE_EXEC}, Origins: make(map[string]Origin), Sensitive: true}
+	var errs Errors
+
+	params := make([]string, 0, len(s.Commands))
+	for param := range s.Commands {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		command := s.Commands[param]
+		origin := Origin{Source: SOURCE_EXEC, File: strings.Join(command, " ")}
+		value, err := s.run(ctx, param, command)
+		if err != nil {
+			errs = append(errs, &ParamError{Param: param, Origin: origin, Err: err})
+			continue
+		}
+		tree.Values[param] = value
+		tree.Origins[docPath(param)] = origin
+	}
+	if len(errs) > 0 {
+		return tree, errs
+	}
+	return tree, nil
+}
+
+// Returns the cached value of a param, or runs its command.
+func (s *ExecSource) run(ctx context.Context, param string, command []string) (interface{}, error) {
+	if len(command) == 0 || command[0] == "" {
+		return nil, fmt.Errorf("no command given")
+	}
+	s.mu.Lock()
+	cached, ok := s.cache[param]
+	s.mu.Unlock()
+	if ok && (s.CacheTTL <= 0 || time.Since(cached.at) < s.CacheTTL) {
+		log.Debugf("--> Using cached output of '%s' for param %s", command[0], param)
+		return cached.value, nil
+	}
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir, cmd.Env = s.Dir, s.Env
+	// Killing a command that forked (e.g. a shell script like pass) leaves
+	// its children holding stdout; stop waiting for them shortly after.
+	cmd.WaitDelay = execWaitDelay
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	log.Debugf("--> Running '%s' for param %s", command[0], param)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("command '%s' timed out after %s", command[0], timeout)
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("command '%s' failed: %v: %s", command[0], err, firstLine(message))
+		}
+		return nil, fmt.Errorf("command '%s' failed: %v", command[0], err)
+	}
+
+	value := decodeStoreValue(bytes.TrimSuffix(bytes.TrimSuffix(stdout.Bytes(), []byte("\n")), []byte("\r")))
+	s.mu.Lock()
+	if s.cache == nil {
+		s.cache = make(map[string]execResult)
+	}
+	s.cache[param] = execResult{value: value, at: time.Now()}
+	s.mu.Unlock()
+	return value, nil
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,96 @@
+package appconfig
+
+import "bytes"
+import "context"
+import "os"
+import "os/exec"
+import "path/filepath"
+import "strings"
+import "testing"
+import "time"
+
+import log "github.com/sirupsen/logrus"
+
+func requireShell(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run helper commands")
+	}
+}
+
+func TestExecSourceTimeout(t *testing.T) {
+	requireShell(t)
+	// The shell forks sleep, which keeps stdout open after the shell is killed
+	source := &ExecSource{Commands: map[string][]string{"secret": {"sh", "-c", "sleep 8; echo hi"}}, Timeout: 200 * time.Millisecond}
+	start := time.Now()
+	_, err := source.Load(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "timed out after 200ms") {
+		t.Errorf("got %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("took %v, want the timeout to bound the run", elapsed)
+	}
+}
+
+func TestExecSourceCache(t *testing.T) {
+	requireShell(t)
+	runs := filepath.Join(t.TempDir(), "runs")
+	command := []string{"sh", "-c", `echo run >> "$0"; echo '{"user": "app"}'`, runs}
+	countRuns := func() int {
+		data, _ := os.ReadFile(runs)
+		return strings.Count(string(data), "run")
+	}
+
+	source := &ExecSource{Commands: map[string][]string{"db": command}}
+	for i := 0; i < 2; i++ {
+		tree, err := source.Load(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if db, ok := tree.Values["db"].(map[string]interface{}); !ok || db["user"] != "app" || !tree.Sensitive {
+			t.Errorf("got %v (sensitive %v), want the decoded object, sensitive", tree.Values, tree.Sensitive)
+		}
+	}
+	if n := countRuns(); n != 1 {
+		t.Errorf("command ran %d times, want once without CacheTTL", n)
+	}
+
+	source.CacheTTL = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRuns(); n != 2 {
+		t.Errorf("command ran %d times, want again once CacheTTL has passed", n)
+	}
+}
+
+func TestExecSourceNeverLogsOutput(t *testing.T) {
+	requireShell(t)
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	level := log.GetLevel()
+	log.SetLevel(log.DebugLevel)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetLevel(level)
+	}()
+
+	source := &ExecSource{Commands: map[string][]string{
+		"password": {"sh", "-c", "echo hunter2"},
+		"failing":  {"sh", "-c", "printf hunt; echo er3; exit 1"},
+	}}
+	tree, err := source.Load(context.Background())
+	if err == nil {
+		t.Error("no error for a failing command")
+	}
+	if tree.Values["password"] != "hunter2" {
+		t.Errorf("got %v", tree.Values)
+	}
+	source.Load(context.Background()) // logs the cached value being used
+	if strings.Contains(logged.String(), "hunter") {
+		t.Errorf("output logged: %s", logged.String())
+	}
+	if err != nil && strings.Contains(err.Error(), "hunter") {
+		t.Errorf("output in error: %v", err)
+	}
+}
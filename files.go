@@ -0,0 +1,220 @@
+package appconfig
+
+import "fmt"
+import "io"
+import "os"
+import "path/filepath"
+import "sort"
+import "strings"
+
+import log "github.com/sirupsen/logrus"
+
+// Extensions of the files read from a conf.d style directory.
+var configFileExtensions = []string{".json", ".jsonc", ".json5"}
+
+// Expands the value of the PARAM_CONFIG_JSON_FILE param into the ordered list
+// of files to read. The value is a list separated by os.PathListSeparator (like
+// $PATH) in which each entry is one of:
+//   - a file, which must exist
+//   - a glob such as "conf/*.json", whose matching files are read in lexical order (no matches is fine)
+//   - a directory such as "conf.d", whose files with a configFileExtensions extension are read in lexical order
+//
+// Files are merged in the order returned, each overriding the previous.
+func expandConfigFiles(value string) ([]string, error) {
+	var files []string
+	for _, entry := range filepath.SplitList(value) {
+		if entry == "" {
+			continue
+		}
+
+		if strings.ContainsAny(entry, "*?[") {
+			matches, err := filepath.Glob(entry)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid config file pattern '%s': %v", entry, err)
+			}
+			sort.Strings(matches)
+			log.Debugf("--> Config file pattern '%s' matches: %v", entry, matches)
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() { // e.g. "conf.d/*" also matches subdirectories
+					files = append(files, match)
+				}
+			}
+			continue
+		}
+
+		info, err := os.Stat(entry)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, entry)
+			continue
+		}
+
+		dirEntries, err := os.ReadDir(entry) // sorted by filename
+		if err != nil {
+			return nil, err
+		}
+		var dirFiles []string
+		for _, dirEntry := range dirEntries {
+			if strings.HasPrefix(dirEntry.Name(), ".") || dirEntry.IsDir() || !hasConfigFileExtension(dirEntry.Name()) {
+				continue
+			}
+			dirFiles = append(dirFiles, filepath.Join(entry, dirEntry.Name()))
+		}
+		log.Debugf("--> Config directory '%s' contains: %v", entry, dirFiles)
+		files = append(files, dirFiles...)
+	}
+	return files, nil
+}
+
+func hasConfigFileExtension(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, configExt := range configFileExtensions {
+		if ext == configExt {
+			return true
+		}
+	}
+	return false
+}
+
+// Key of a config document that names other files to pull in: either a
+// string or a list of strings, each a file, glob or directory as accepted by
+// PARAM_CONFIG_JSON_FILE. Relative paths are relative to the including file.
+// The included files are merged beneath the including document.
+const includeKey = "include"
+
+// A parsed config document (with its includes merged in), together with the
+// origin of every value in it.
+type configDocument struct {
+	vals    map[string]interface{}
+	origins map[string]Origin // by docPath(), for every key at every depth
+}
+
+// Reads a config file and the files it includes. chain holds the absolute
+// paths of the files currently being included, to detect include cycles.
+func loadConfigFile(fileName string, params map[string]Param, opts Options, chain []string) (configDocument, error) {
+	abs, err := filepath.Abs(fileName)
+	if err != nil {
+		return configDocument{}, err
+	}
+	for _, including := range chain {
+		if including == abs {
+			return configDocument{}, fmt.Errorf("Config file include cycle: %s -> %s.", strings.Join(chain, " -> "), abs)
+		}
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return configDocument{}, err
+	}
+	defer f.Close()
+
+	return loadConfigDocument(f, fileName, filepath.Dir(fileName), Origin{Source: SOURCE_FILE, File: fileName}, params, opts, append(chain, abs))
+}
+
+// Parses a config document from r and merges it on top of the files it
+// includes. Relative includes are resolved against dir.
+func loadConfigDocument(r io.Reader, name string, dir string, origin Origin, params map[string]Param, opts Options, chain []string) (configDocument, error) {
+	vals, positions, err := parseJsonFromFile(r, name, isRelaxedJsonFile(name, opts))
+	if err != nil {
+		return configDocument{}, err
+	}
+
+	var includes []string
+	switch include := vals[includeKey].(type) {
+	case nil:
+	case string:
+		includes = []string{include}
+	case []interface{}:
+		for _, entry := range include {
+			file, ok := entry.(string)
+			if !ok {
+				return configDocument{}, fmt.Errorf("Non-string '%s' entry in JSON file '%s': %v.", includeKey, name, entry)
+			}
+			includes = append(includes, file)
+		}
+	default:
+		return configDocument{}, fmt.Errorf("Invalid '%s' value in JSON file '%s': %v.", includeKey, name, include)
+	}
+	delete(vals, includeKey)
+
+	doc := configDocument{vals: make(map[string]interface{}), origins: make(map[string]Origin)}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(dir, include)
+		}
+		files, err := expandConfigFiles(include)
+		if err != nil {
+			return configDocument{}, fmt.Errorf("Cannot include '%s' from JSON file '%s': %v", include, name, err)
+		}
+		for _, file := range files {
+			log.Debugf("--> JSON file '%s' includes '%s'", name, file)
+			included, err := loadConfigFile(file, params, opts, chain)
+			if err != nil {
+				return configDocument{}, err
+			}
+			doc = mergeDocuments(params, doc, included)
+		}
+	}
+
+	own := configDocument{vals: vals, origins: make(map[string]Origin)}
+	setDocumentOrigins(own.origins, vals, origin, positions)
+	return mergeDocuments(params, doc, own), nil
+}
+
+// Records the origin (with the position of the key) of every key of a parsed
+// document, at every depth.
+func setDocumentOrigins(origins map[string]Origin, vals map[string]interface{}, origin Origin, positions map[string]position, parents ...string) {
+	for key, value := range vals {
+		path := append(append([]string{}, parents...), key)
+		keyOrigin := origin
+		if pos, ok := positions[docPath(path...)]; ok {
+			keyOrigin.Line, keyOrigin.Column = pos.line, pos.column
+		}
+		origins[docPath(path...)] = keyOrigin
+		if child, ok := value.(map[string]interface{}); ok {
+			setDocumentOrigins(origins, child, origin, positions, path...)
+		}
+	}
+}
+
+// Merges a higher-precedence document onto a lower one.
+func mergeDocuments(params map[string]Param, base configDocument, overlay configDocument) configDocument {
+	merged := configDocument{vals: mergeDocumentVals(params, base.vals, overlay.vals), origins: make(map[string]Origin, len(base.origins)+len(overlay.origins))}
+	for path, origin := range base.origins {
+		merged.origins[path] = origin
+	}
+	for path, origin := range overlay.origins {
+		merged.origins[path] = origin
+	}
+	return merged
+}
+
+// Merges the keys of a higher-precedence document or node onto a lower one.
+// Values of params are combined with mergeValue() according to the param's
+// Merge strategy; other objects (e.g. config nodes) are merged recursively.
+// A null value removes the key.
+func mergeDocumentVals(params map[string]Param, base map[string]interface{}, overlay map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(overlay))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overlay {
+		existing, exists := merged[key]
+		p, isParam := params[key]
+		existingMap, existingIsMap := existing.(map[string]interface{})
+		valueMap, valueIsMap := value.(map[string]interface{})
+		switch {
+		case value == nil:
+			delete(merged, key)
+		case isParam && exists:
+			merged[key] = mergeValue(p, existing, value)
+		case !isParam && existingIsMap && valueIsMap:
+			merged[key] = mergeDocumentVals(params, existingMap, valueMap)
+		default:
+			merged[key] = value
+		}
+	}
+	return merged
+}
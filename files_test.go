@@ -0,0 +1,45 @@
+package appconfig
+
+import "os"
+import "path/filepath"
+import "reflect"
+import "testing"
+
+func TestExpandConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"conf.d/10-base.json", "conf.d/20-local.jsonc", "conf.d/notes.txt", "conf.d/sub/30-nested.json", "main.json"} {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	confDir, main := filepath.Join(dir, "conf.d"), filepath.Join(dir, "main.json")
+
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{main, []string{main}},
+		{confDir, []string{filepath.Join(confDir, "10-base.json"), filepath.Join(confDir, "20-local.jsonc")}},
+		{filepath.Join(confDir, "*"), []string{filepath.Join(confDir, "10-base.json"), filepath.Join(confDir, "20-local.jsonc"), filepath.Join(confDir, "notes.txt")}}, // not the subdirectory
+		{filepath.Join(dir, "*.toml"), nil},
+		{main + string(os.PathListSeparator) + filepath.Join(confDir, "1*"), []string{main, filepath.Join(confDir, "10-base.json")}},
+	}
+	for _, test := range tests {
+		got, err := expandConfigFiles(test.value)
+		if err != nil {
+			t.Errorf("%s: %v", test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.value, got, test.want)
+		}
+	}
+
+	if _, err := expandConfigFiles(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
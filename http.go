@@ -0,0 +1,261 @@
+package appconfig
+
+import "context"
+import "crypto/tls"
+import "crypto/x509"
+import "fmt"
+import "io"
+import "mime"
+import "net/http"
+import "os"
+import "path"
+import "path/filepath"
+import "strings"
+import "sync"
+import "time"
+
+import log "github.com/sirupsen/logrus"
+
+// Name of the HttpSource, as used in Origin.Source.
+const SOURCE_HTTP = "http"
+
+// HttpSource is a Source that fetches a JSON or YAML config document from a
+// URL. Like a config file, the document may contain several nodes, of which
+// the PARAM_CONFIG_NODE node(s) are used.
+//
+// Requests are conditional (If-None-Match/If-Modified-Since) once the
+// document has been fetched, so reloads and polling (see Config.Watch())
+// only transfer it when it has changed. Every fetched document is saved to
+// CacheFile, which is used as the last known good copy when the server can't
+// be reached or returns an error.
+type HttpSource struct {
+	URL          string         // URL of the document. If empty, the value of the param URLParam is used.
+	URLParam     string         // Name of a param holding the URL (e.g. "config-url"), used if URL is empty.
+	Format       string         // "json" or "yaml". Empty means by Content-Type or URL extension, or else by the content.
+	Header       http.Header    // Extra request headers, e.g. for authorization.
+	Timeout      time.Duration  // Timeout of each request. Default is 10 seconds.
+	RootCAs      *x509.CertPool // TLS root certificates to trust instead of the system's.
+	CAFile       string         // PEM file with TLS root certificates to trust instead of the system's, if RootCAs is nil.
+	CacheFile    string         // Where the last known good document is kept. Empty means no cache.
+	PollInterval time.Duration  // How often Watch() checks for changes. Default is 30 seconds.
+	MaxSize      int64          // Largest document accepted, in bytes. Default is 10 MiB.
+	Client       *http.Client   // Client to use instead of one built from Timeout, RootCAs and CAFile.
+
+	mu           sync.Mutex
+	url          string // the URL last loaded, for Watch()
+	body         []byte // the last document fetched
+	format       string // format of body
+	etag         string
+	lastModified string
+}
+
+func (s *HttpSource) Name() string {
+	return SOURCE_HTTP
+}
+
+// Load fetches the document, or uses the last known good copy if that fails.
+func (s *HttpSource) Load(ctx context.Context) (*Tree, error) {
+	url := s.URL
+	if url == "" {
+		url = lookupString(ctx, s.URLParam)
+	}
+	if url == "" {
+		log.Debugf("No URL for the HTTP source.")
+		return nil, nil
+	}
+
+	_, err := s.fetch(ctx, url)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		return documentTree(s.body, s.format, Origin{Source: SOURCE_HTTP, File: url})
+	}
+	if s.body != nil {
+		log.WithFields(log.Fields{"err": err}).Warnf("Cannot fetch '%s', using the copy fetched before.", url)
+		return documentTree(s.body, s.format, Origin{Source: SOURCE_HTTP, File: url})
+	}
+	if s.CacheFile != "" {
+		if cached, cacheErr := os.ReadFile(s.CacheFile); cacheErr == nil {
+			log.WithFields(log.Fields{"err": err}).Warnf("Cannot fetch '%s', using the last known good copy '%s'.", url, s.CacheFile)
+			return documentTree(cached, documentFormat(s.Format, "", url), Origin{Source: SOURCE_HTTP, File: s.CacheFile})
+		}
+	}
+	return nil, err
+}
+
+// Watch polls the URL every PollInterval and calls changed() whenever a
+// different document is returned. Failed polls are logged and retried.
+func (s *HttpSource) Watch(ctx context.Context, changed func()) error {
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		url := s.url
+		s.mu.Unlock()
+		if url == "" {
+			continue
+		}
+		updated, err := s.fetch(ctx, url)
+		if err != nil {
+			log.WithFields(log.Fields{"err": err}).Warnf("Cannot poll '%s'.", url)
+		} else if updated {
+			log.Infof("Configuration at '%s' has changed.", url)
+			changed()
+		}
+	}
+}
+
+// Fetches the document at url, unless it hasn't changed since the last fetch.
+// Reports whether a different document was fetched.
+func (s *HttpSource) fetch(ctx context.Context, url string) (bool, error) {
+	client, err := s.client()
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	for key, values := range s.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	s.mu.Lock()
+	if url != s.url { // the validators belong to another URL
+		s.url, s.body, s.etag, s.lastModified = url, nil, "", ""
+	}
+	if s.body != nil {
+		if s.etag != "" {
+			req.Header.Set("If-None-Match", s.etag)
+		}
+		if s.lastModified != "" {
+			req.Header.Set("If-Modified-Since", s.lastModified)
+		}
+	}
+	s.mu.Unlock()
+
+	log.Debugf("--> Fetching '%s'", url)
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		log.Debugf("--> '%s' has not been modified", url)
+		return false, nil
+	case resp.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("Cannot fetch '%s': %s.", url, resp.Status)
+	}
+	maxSize := s.MaxSize
+	if maxSize <= 0 {
+		maxSize = 10 << 20
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return false, fmt.Errorf("Cannot fetch '%s': %v.", url, err)
+	}
+	if int64(len(body)) > maxSize {
+		return false, fmt.Errorf("Cannot fetch '%s': document is larger than %d bytes.", url, maxSize)
+	}
+	format := documentFormat(s.Format, resp.Header.Get("Content-Type"), url)
+	if _, err := documentTree(body, format, Origin{Source: SOURCE_HTTP, File: url}); err != nil {
+		return false, err // not good, so don't keep it
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	updated := string(body) != string(s.body)
+	s.body, s.format = body, format
+	s.etag, s.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if updated && s.CacheFile != "" {
+		if err := writeFileAtomically(s.CacheFile, body); err != nil {
+			log.WithFields(log.Fields{"err": err}).Warnf("Cannot save the last known good copy of '%s'.", url)
+		}
+	}
+	return updated, nil
+}
+
+func (s *HttpSource) client() (*http.Client, error) {
+	if s.Client != nil {
+		return s.Client, nil
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	roots := s.RootCAs
+	if roots == nil && s.CAFile != "" {
+		pem, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in CA file '%s'.", s.CAFile)
+		}
+	}
+	if roots == nil {
+		return &http.Client{Timeout: timeout}, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// Determines the format of a document from an explicit format, a Content-Type
+// or the extension of its URL or file name. Returns "" if unknown.
+func documentFormat(format string, contentType string, name string) string {
+	if format != "" {
+		return format
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			return "json"
+		case strings.Contains(mediaType, "yaml"):
+			return "yaml"
+		}
+	}
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return ""
+}
+
+// Writes a file by renaming a temporary file over it, so that readers never
+// see a partial file.
+func writeFileAtomically(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
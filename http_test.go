@@ -0,0 +1,140 @@
+package appconfig
+
+import "context"
+import "net/http"
+import "net/http/httptest"
+import "path/filepath"
+import "strings"
+import "sync"
+import "testing"
+
+// A config server whose document can be changed or made to fail, and which
+// answers conditional requests with 304 Not Modified.
+type testConfigServer struct {
+	mu          sync.Mutex
+	body        string
+	etag        string
+	fail        bool
+	notModified int
+}
+
+func (s *testConfigServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Header.Get("If-None-Match") == s.etag {
+		s.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(s.body))
+}
+
+func (s *testConfigServer) set(body string, etag string, fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.etag, s.fail = body, etag, fail
+}
+
+func TestHttpSourceConditionalRequests(t *testing.T) {
+	server := &testConfigServer{body: `{"port": 80}`, etag: `"v1"`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	source := &HttpSource{URL: ts.URL + "/config"}
+
+	tree, err := source.Load(context.Background())
+	if err != nil || tree.Values["port"] != 80.0 {
+		t.Fatalf("got %v, %v", tree, err)
+	}
+	if updated, err := source.fetch(context.Background(), ts.URL+"/config"); err != nil || updated {
+		t.Errorf("unchanged document: updated %v, err %v", updated, err)
+	}
+	tree, err = source.Load(context.Background())
+	if err != nil || tree.Values["port"] != 80.0 {
+		t.Fatalf("got %v, %v after 304", tree, err)
+	}
+	server.mu.Lock()
+	notModified := server.notModified
+	server.mu.Unlock()
+	if notModified != 2 {
+		t.Errorf("got %d 304 responses, want 2", notModified)
+	}
+
+	server.set(`{"port": 81}`, `"v2"`, false)
+	if updated, err := source.fetch(context.Background(), ts.URL+"/config"); err != nil || !updated {
+		t.Errorf("changed document: updated %v, err %v", updated, err)
+	}
+	if tree, _ := source.Load(context.Background()); tree.Values["port"] != 81.0 {
+		t.Errorf("got %v, want the new document", tree.Values)
+	}
+}
+
+func TestHttpSourceLastKnownGood(t *testing.T) {
+	server := &testConfigServer{body: `{"port": 80}`, etag: `"v1"`}
+	ts := httptest.NewServer(server)
+	cacheFile := filepath.Join(t.TempDir(), "config.cache")
+	source := &HttpSource{URL: ts.URL + "/config", CacheFile: cacheFile}
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server fails: the document fetched before is used
+	server.set("", "", true)
+	tree, err := source.Load(context.Background())
+	if err != nil || tree.Values["port"] != 80.0 {
+		t.Fatalf("got %v, %v while the server fails", tree, err)
+	}
+
+	// An invalid document is not kept
+	server.set(`{"port": `, `"v2"`, false)
+	if _, err := source.fetch(context.Background(), ts.URL+"/config"); err == nil {
+		t.Error("invalid document accepted")
+	}
+
+	// A new source (e.g. after a restart) falls back to the cache file
+	ts.Close()
+	restarted := &HttpSource{URL: ts.URL + "/config", CacheFile: cacheFile}
+	tree, err = restarted.Load(context.Background())
+	if err != nil || tree.Values["port"] != 80.0 {
+		t.Fatalf("got %v, %v from the cache file", tree, err)
+	}
+	if tree.Origin.File != cacheFile {
+		t.Errorf("got origin %v, want the cache file", tree.Origin)
+	}
+
+	// Without a cache file, the error is returned
+	if _, err := (&HttpSource{URL: ts.URL + "/config"}).Load(context.Background()); err == nil {
+		t.Error("no error without any copy of the document")
+	}
+}
+
+func TestHttpSourceYamlAliasBomb(t *testing.T) {
+	bomb := "a: &a [x, x, x, x, x, x, x, x, x, x]\n"
+	for _, name := range []string{"b", "c", "d", "e", "f", "g"} {
+		prev := string(rune(name[0] - 1))
+		bomb += name + ": &" + name + " [*" + prev + strings.Repeat(", *"+prev, 9) + "]\n"
+	}
+	server := &testConfigServer{body: bomb, etag: `"v1"`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	if _, err := (&HttpSource{URL: ts.URL + "/config.yaml", Format: "yaml"}).Load(context.Background()); err == nil {
+		t.Error("document expanding to millions of nodes accepted")
+	}
+}
+
+func TestHttpSourceMaxSize(t *testing.T) {
+	server := &testConfigServer{body: `{"name": "` + strings.Repeat("x", 100) + `"}`, etag: `"v1"`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	if _, err := (&HttpSource{URL: ts.URL + "/config", MaxSize: 100}).Load(context.Background()); err == nil || !strings.Contains(err.Error(), "larger than 100 bytes") {
+		t.Errorf("got %v, want an error for the document size", err)
+	}
+	if _, err := (&HttpSource{URL: ts.URL + "/config", MaxSize: 200}).Load(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
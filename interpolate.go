@@ -0,0 +1,178 @@
+package appconfig
+
+import "fmt"
+import "os"
+import "reflect"
+import "strings"
+
+import log "github.com/sirupsen/logrus"
+
+// Expands the values of every param with Interpolate set. A reference to a
+// param that also has Interpolate set uses its expanded value, so references
+// are resolved in dependency order.
+func interpolateValues(c *Config) Errors {
+	in := interpolator{config: c, done: make(map[string]bool)}
+	var errs Errors
+	for _, param := range sortedKeys(c.params) {
+		if !c.params[param].Interpolate {
+			continue
+		}
+		if err := in.resolve(param); err != nil {
+			errs = append(errs, &ParamError{Param: param, Origin: c.origins[param], Value: c.values[param], Err: err})
+		}
+	}
+	return errs
+}
+
+type interpolator struct {
+	config *Config
+	done   map[string]bool // params already expanded (or failed)
+	chain  []string        // params currently being expanded, to detect cycles
+}
+
+func (in *interpolator) resolve(param string) error {
+	if in.done[param] {
+		return nil
+	}
+	for _, resolving := range in.chain {
+		if resolving == param {
+			return fmt.Errorf("%w: reference cycle %s -> %s", ErrInterpolation, strings.Join(in.chain, " -> "), param)
+		}
+	}
+	in.chain = append(in.chain, param)
+	defer func() { in.chain = in.chain[:len(in.chain)-1] }()
+
+	value, ok := in.config.values[param]
+	if !ok {
+		in.done[param] = true
+		return nil
+	}
+	expanded, err := in.expandValue(value)
+	in.done[param] = true
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(expanded, value) {
+		log.Debugf("----> Interpolated param %s: %v", param, redact(in.config.Sensitive(param), expanded))
+	}
+	in.config.values[param] = expanded
+	return nil
+}
+
+func (in *interpolator) expandValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return in.expand(v)
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			var err error
+			if expanded[key], err = in.expandValue(child); err != nil {
+				return nil, err
+			}
+		}
+		return expanded, nil
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		for i, child := range v {
+			var err error
+			if expanded[i], err = in.expandValue(child); err != nil {
+				return nil, err
+			}
+		}
+		return expanded, nil
+	}
+	return value, nil
+}
+
+// Expands the references in a single string.
+func (in *interpolator) expand(s string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			out.WriteByte('$')
+			i++
+		case '{':
+			end := matchingBrace(s, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("%w: unterminated '${' in '%s'", ErrInterpolation, s)
+			}
+			expanded, err := in.expandReference(s[i+2 : end])
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(expanded)
+			i = end
+		default:
+			out.WriteByte('$')
+		}
+	}
+	return out.String(), nil
+}
+
+// Expands the inside of ${...}: a name with an optional ":-" default.
+func (in *interpolator) expandReference(ref string) (string, error) {
+	name, def, hasDefault := ref, "", false
+	if n := strings.Index(ref, ":-"); n >= 0 {
+		name, def, hasDefault = ref[:n], ref[n+2:], true
+	}
+	if name == "" {
+		return "", fmt.Errorf("%w: empty reference '${%s}'", ErrInterpolation, ref)
+	}
+
+	value, err := in.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	if value == "" && hasDefault {
+		return in.expand(def)
+	}
+	return value, nil
+}
+
+// Returns the value of a param (expanding it first if it has Interpolate set)
+// or, if there is no such param, of an environmental variable.
+func (in *interpolator) lookup(name string) (string, error) {
+	p, isParam := in.config.params[name]
+	if !isParam {
+		return os.Getenv(name), nil
+	}
+	if p.Interpolate {
+		if err := in.resolve(name); err != nil {
+			return "", err
+		}
+	}
+	value, ok := in.config.values[name]
+	if !ok || value == nil {
+		return "", nil
+	}
+	if in.config.Sensitive(name) { // the secret becomes part of the params expanding it
+		for _, param := range in.chain {
+			in.config.sensitive[param] = true
+		}
+	}
+	return fmt.Sprint(value), nil
+}
+
+// Returns the index of the '}' closing the '{' at s[open], allowing nested
+// ${...} in defaults, or -1.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
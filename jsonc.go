@@ -0,0 +1,399 @@
+package appconfig
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "path/filepath"
+import "regexp"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+
+// Extensions of config files that are always read with the relaxed parser.
+var relaxedJsonExtensions = []string{".jsonc", ".json5"}
+
+// Reports whether a config file should be read with the relaxed parser,
+// based on its extension or Options.RelaxedJson.
+func isRelaxedJsonFile(fileName string, opts Options) bool {
+	if opts.RelaxedJson {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, relaxedExt := range relaxedJsonExtensions {
+		if ext == relaxedExt {
+			return true
+		}
+	}
+	return false
+}
+
+// A JSON parser for config documents. Unlike encoding/json it reports errors
+// with line and column and, when relaxed, accepts the JSONC/JSON5 extensions
+// operators like to use in hand-written files:
+//   - line (//) and block (/* */) comments
+//   - trailing commas in objects and lists
+//   - unquoted keys such as {debug: true}
+//   - single-quoted strings
+//   - hexadecimal numbers (0x1F) and a leading "+" sign
+//
+// Values are unmarshalled to the same types as encoding/json produces
+// (map[string]interface{}, []interface{}, string, float64, bool and nil).
+type jsonParser struct {
+	data      []byte
+	pos       int
+	relaxed   bool
+	positions map[string]position // position of each object key by docPath(), outside of lists
+	scanned   int                 // offset up to which lines and columns have been counted, see position()
+	scannedAt position            // line and column at scanned
+}
+
+// A 1-based line and column (in characters) in a config file.
+type position struct {
+	line, column int
+}
+
+var strictJsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// Parses a document whose top-level value must be an object. Also returns the
+// position of every object key (outside of lists) by docPath().
+func parseJsonDocument(data []byte, relaxed bool) (map[string]interface{}, map[string]position, error) {
+	p := &jsonParser{data: data, relaxed: relaxed, positions: make(map[string]position), scannedAt: position{1, 1}}
+	if err := p.skipSpace(); err != nil {
+		return nil, nil, err
+	}
+	if p.peek() != '{' {
+		return nil, nil, p.errorf("expected a JSON object")
+	}
+	value, err := p.parseValue([]string{})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := p.skipSpace(); err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.data) {
+		return nil, nil, p.errorf("unexpected %s after the end of the document", p.describe())
+	}
+	return value.(map[string]interface{}), p.positions, nil
+}
+
+// Parses the value at path (nil inside lists, where keys aren't recorded).
+func (p *jsonParser) parseValue(path []string) (interface{}, error) {
+	if err := p.skipSpace(); err != nil {
+		return nil, err
+	}
+	switch c := p.peek(); {
+	case c == '{':
+		return p.parseObject(path)
+	case c == '[':
+		return p.parseList()
+	case c == '"' || (c == '\'' && p.relaxed):
+		return p.parseString()
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case isIdentifierByte(c):
+		start := p.pos
+		word := p.scanIdentifier()
+		switch word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		p.pos = start
+		return nil, p.errorf("unexpected '%s'", word)
+	}
+	return nil, p.errorf("unexpected %s", p.describe())
+}
+
+func (p *jsonParser) parseObject(path []string) (interface{}, error) {
+	p.pos++ // '{'
+	obj := make(map[string]interface{})
+	for {
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		if p.peek() == '}' {
+			p.pos++
+			return obj, nil
+		}
+
+		var key string
+		keyStart := p.pos
+		switch c := p.peek(); {
+		case c == '"' || (c == '\'' && p.relaxed):
+			s, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		case p.relaxed && isIdentifierByte(c):
+			key = p.scanIdentifier()
+		default:
+			return nil, p.errorf("expected a key or '}', found %s", p.describe())
+		}
+
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		if p.peek() != ':' {
+			return nil, p.errorf("expected ':' after key '%s', found %s", key, p.describe())
+		}
+		p.pos++
+
+		var keyPath []string
+		if path != nil {
+			keyPath = append(append([]string{}, path...), key)
+			p.positions[docPath(keyPath...)] = p.position(keyStart)
+		}
+		value, err := p.parseValue(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = value
+
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+			if err := p.skipSpace(); err != nil {
+				return nil, err
+			}
+			if p.peek() == '}' && !p.relaxed {
+				return nil, p.errorf("trailing comma before '}'")
+			}
+		case '}':
+		default:
+			return nil, p.errorf("expected ',' or '}', found %s", p.describe())
+		}
+	}
+}
+
+func (p *jsonParser) parseList() (interface{}, error) {
+	p.pos++ // '['
+	list := []interface{}{}
+	for {
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return list, nil
+		}
+		value, err := p.parseValue(nil)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+			if err := p.skipSpace(); err != nil {
+				return nil, err
+			}
+			if p.peek() == ']' && !p.relaxed {
+				return nil, p.errorf("trailing comma before ']'")
+			}
+		case ']':
+		default:
+			return nil, p.errorf("expected ',' or ']', found %s", p.describe())
+		}
+	}
+}
+
+func (p *jsonParser) parseString() (string, error) {
+	start := p.pos
+	quote := p.data[p.pos]
+	for i := p.pos + 1; i < len(p.data); i++ {
+		switch p.data[i] {
+		case '\\':
+			i++
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case quote:
+			raw := p.data[start : i+1]
+			if quote == '\'' {
+				raw = requoteString(raw)
+			}
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return "", p.errorf("invalid string: %v", err)
+			}
+			p.pos = i + 1
+			return s, nil
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// Turns a single-quoted string into a double-quoted one so encoding/json can
+// decode the escapes: \' becomes ', a bare " is escaped and other escapes,
+// including \", are kept as they are.
+func requoteString(raw []byte) []byte {
+	requoted := make([]byte, 0, len(raw)+2)
+	requoted = append(requoted, '"')
+	for i := 1; i < len(raw)-1; i++ {
+		switch c := raw[i]; {
+		case c == '\\' && raw[i+1] == '\'':
+			requoted = append(requoted, '\'')
+			i++
+		case c == '\\':
+			requoted = append(requoted, raw[i:i+2]...)
+			i++
+		case c == '"':
+			requoted = append(requoted, '\\', '"')
+		default:
+			requoted = append(requoted, c)
+		}
+	}
+	return append(requoted, '"')
+}
+
+func (p *jsonParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	for p.pos < len(p.data) && strings.IndexByte("+-.0123456789abcdefABCDEFxX", p.data[p.pos]) >= 0 {
+		p.pos++
+	}
+	text := string(p.data[start:p.pos])
+	if strictJsonNumber.MatchString(text) {
+		f, err := strconv.ParseFloat(text, 64)
+		if err == nil {
+			return f, nil
+		}
+	} else if p.relaxed {
+		unsigned := strings.TrimLeft(text, "+-")
+		if strings.HasPrefix(unsigned, "0x") || strings.HasPrefix(unsigned, "0X") {
+			if i, err := strconv.ParseInt(strings.TrimPrefix(text, "+"), 0, 64); err == nil {
+				return float64(i), nil
+			}
+		} else if f, err := strconv.ParseFloat(strings.TrimPrefix(text, "+"), 64); err == nil && !strings.ContainsAny(text, "xX") {
+			return f, nil
+		}
+	}
+	p.pos = start
+	return nil, p.errorf("invalid number '%s'", text)
+}
+
+// Skips whitespace and, when relaxed, comments.
+func (p *jsonParser) skipSpace() error {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case c == '/' && p.relaxed && p.pos+1 < len(p.data) && p.data[p.pos+1] == '/':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == '/' && p.relaxed && p.pos+1 < len(p.data) && p.data[p.pos+1] == '*':
+			end := bytes.Index(p.data[p.pos+2:], []byte("*/"))
+			if end < 0 {
+				return p.errorf("unterminated comment")
+			}
+			p.pos += end + 4
+		case c == '/':
+			return p.errorf("comments are only allowed in .jsonc and .json5 files")
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *jsonParser) peek() byte {
+	if p.pos < len(p.data) {
+		return p.data[p.pos]
+	}
+	return 0
+}
+
+func (p *jsonParser) scanIdentifier() string {
+	start := p.pos
+	for p.pos < len(p.data) && isIdentifierByte(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || c == '-' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= utf8.RuneSelf
+}
+
+// Describes the input at the current position for error messages.
+func (p *jsonParser) describe() string {
+	if p.pos >= len(p.data) {
+		return "end of input"
+	}
+	r, _ := utf8.DecodeRune(p.data[p.pos:])
+	return fmt.Sprintf("'%c'", r)
+}
+
+func (p *jsonParser) errorf(format string, a ...interface{}) error {
+	line, column := lineColumn(p.data, p.pos)
+	lineStart := bytes.LastIndexByte(p.data[:p.pos], '\n') + 1
+	lineEnd := len(p.data)
+	if n := bytes.IndexByte(p.data[lineStart:], '\n'); n >= 0 {
+		lineEnd = lineStart + n
+	}
+	text := strings.TrimRight(string(p.data[lineStart:lineEnd]), "\r")
+	return &JsonSyntaxError{Line: line, Column: column, Text: text, Msg: fmt.Sprintf(format, a...)}
+}
+
+// Returns the line and column of a byte offset. Keys are recorded in order,
+// so counting continues from the previous offset instead of the start of the
+// document, keeping large documents linear to parse.
+func (p *jsonParser) position(offset int) position {
+	if offset < p.scanned {
+		p.scanned, p.scannedAt = 0, position{1, 1}
+	}
+	chunk := p.data[p.scanned:offset]
+	if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+		p.scannedAt.line += bytes.Count(chunk, []byte{'\n'})
+		p.scannedAt.column = utf8.RuneCount(chunk[i+1:]) + 1
+	} else {
+		p.scannedAt.column += utf8.RuneCount(chunk)
+	}
+	p.scanned = offset
+	return p.scannedAt
+}
+
+// Converts a byte offset into a 1-based line and column (in characters).
+func lineColumn(data []byte, offset int) (int, int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	lineStart := bytes.LastIndexByte(data[:offset], '\n') + 1
+	line := bytes.Count(data[:offset], []byte{'\n'}) + 1
+	return line, utf8.RuneCount(data[lineStart:offset]) + 1
+}
+
+// JsonSyntaxError is returned for malformed config files and stdin. The
+// message shows the offending line with a caret under the error position.
+type JsonSyntaxError struct {
+	File   string // name of the file (or stdin) being parsed
+	Line   int    // 1-based
+	Column int    // 1-based, in characters
+	Text   string // the offending line
+	Msg    string
+}
+
+func (e *JsonSyntaxError) Error() string {
+	// Keep tabs in the caret line so it lines up with the text
+	indent := []rune(e.Text)
+	if e.Column-1 < len(indent) {
+		indent = indent[:e.Column-1]
+	}
+	for i, r := range indent {
+		if r != '\t' {
+			indent[i] = ' '
+		}
+	}
+	return fmt.Sprintf("Syntax error in JSON file '%s' at line %d, column %d: %s.\n\t%s\n\t%s^", e.File, e.Line, e.Column, e.Msg, e.Text, string(indent))
+}
@@ -0,0 +1,138 @@
+package appconfig
+
+import "errors"
+import "reflect"
+import "strings"
+import "testing"
+
+func TestParseJsonDocument(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		relaxed bool
+		want    map[string]interface{}
+		errLine int // expected line and column of a JsonSyntaxError, 0 if the input is valid
+		errCol  int
+	}{
+		{
+			name:  "strict",
+			input: `{"port": 8080, "debug": true, "name": "a\"bé", "tags": ["x", null, -1.5e2], "rules": {}}`,
+			want:  map[string]interface{}{"port": 8080.0, "debug": true, "name": "a\"bé", "tags": []interface{}{"x", nil, -150.0}, "rules": map[string]interface{}{}},
+		},
+		{
+			name:    "relaxed extensions",
+			input:   "{\n  // a comment\n  port: 0x1F, /* block */\n  'name': 'single',\n  level: +2,\n  list: [1, 2,],\n}",
+			relaxed: true,
+			want:    map[string]interface{}{"port": 31.0, "name": "single", "level": 2.0, "list": []interface{}{1.0, 2.0}},
+		},
+		{
+			name:    "single-quoted escapes",
+			input:   `{'a': 'x\"y', 'b': 'it\'s "q" \\ \u00e9'}`,
+			relaxed: true,
+			want:    map[string]interface{}{"a": `x"y`, "b": `it's "q" \ é`},
+		},
+		{
+			name:    "comment in strict mode",
+			input:   "{\n  // a comment\n  \"port\": 1\n}",
+			errLine: 2,
+			errCol:  3,
+		},
+		{
+			name:    "trailing comma in strict mode",
+			input:   "{\"port\": 1,\n}",
+			errLine: 2,
+			errCol:  1,
+		},
+		{
+			name:    "missing colon",
+			input:   "{\n  \"a\": 1,\n  \"b\" 2\n}",
+			relaxed: true,
+			errLine: 3,
+			errCol:  7,
+		},
+		{
+			name:    "not an object",
+			input:   "[1, 2]",
+			errLine: 1,
+			errCol:  1,
+		},
+		{
+			name:    "unterminated string",
+			input:   "{\"a\": \"b",
+			errLine: 1,
+			errCol:  7, // where the string starts
+		},
+		{
+			name:    "trailing data",
+			input:   "{} {}",
+			errLine: 1,
+			errCol:  4,
+		},
+		{
+			name:    "leading zero",
+			input:   `{"a": 01}`,
+			errLine: 1,
+			errCol:  7,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _, err := parseJsonDocument([]byte(test.input), test.relaxed)
+			if test.errLine == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(got, test.want) {
+					t.Errorf("got %#v, want %#v", got, test.want)
+				}
+				return
+			}
+			var syntaxErr *JsonSyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("got %v, want a JsonSyntaxError", err)
+			}
+			if syntaxErr.Line != test.errLine || syntaxErr.Column != test.errCol {
+				t.Errorf("error at line %d, column %d, want line %d, column %d: %v", syntaxErr.Line, syntaxErr.Column, test.errLine, test.errCol, err)
+			}
+		})
+	}
+}
+
+func TestParseJsonDocumentPositions(t *testing.T) {
+	input := "{\n  \"proxy\": {\n    \"port\": 1, \"héllo\": 2,\n    \"list\": [{\"inner\": 3}]\n  }\n}"
+	_, positions, err := parseJsonDocument([]byte(input), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]position{
+		docPath("proxy"):          {2, 3},
+		docPath("proxy", "port"):  {3, 5},
+		docPath("proxy", "héllo"): {3, 16},
+		docPath("proxy", "list"):  {4, 5},
+	}
+	if !reflect.DeepEqual(positions, want) {
+		t.Errorf("got %v, want %v", positions, want)
+	}
+}
+
+func TestParseJsonDocumentLarge(t *testing.T) {
+	// Positions are counted incrementally and comments are skipped without
+	// copying the rest of the document; recounting or copying from the start
+	// for every key or comment made documents like this one take many seconds.
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 0; i < 20000; i++ {
+		b.WriteString("\n  \"key")
+		b.WriteString(strings.Repeat("x", i%7))
+		b.WriteString(string(rune('a' + i%26)))
+		b.WriteString("\": {\"value\": \"0123456789\", \"list\": [1, 2, 3]}, /* a block comment */ // and a line comment")
+	}
+	b.WriteString("\n  \"last\": true\n}")
+	_, positions, err := parseJsonDocument([]byte(b.String()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := positions[docPath("last")]; got != (position{20002, 3}) {
+		t.Errorf("got %v for the last key", got)
+	}
+}
@@ -0,0 +1,116 @@
+package appconfig
+
+import "reflect"
+
+// MergeStrategy is an optional property of the Param struct that determines
+// how a value from one layer (default, config files, stdin, environmental
+// variables, command-line) is combined with the value from the layers below.
+type MergeStrategy int
+
+// Constants for the MergeStrategy type.
+const (
+	MERGE_REPLACE MergeStrategy = iota // Each layer replaces the whole value. This is the default.
+	MERGE_DEEP                         // Objects are merged key by key, recursively. A null value removes the key (as in JSON Merge Patch, RFC 7396).
+	MERGE_APPEND                       // Lists are concatenated, lower layers first.
+	MERGE_UNION                        // Lists are concatenated, lower layers first, dropping duplicate entries.
+)
+
+// Combines the value of a param from a higher layer (overlay) with the value
+// accumulated from the layers below (base). Neither argument is modified, so
+// Default values and layer maps are never changed by merging. When the values
+// aren't both objects (MERGE_DEEP) or both lists (MERGE_APPEND, MERGE_UNION),
+// the overlay replaces the base.
+func mergeValue(p Param, base interface{}, overlay interface{}) interface{} {
+	if p.Type == PARAM_LIST {
+		if list, err := convertValue(PARAM_LIST, overlay); err == nil {
+			overlay = list
+		}
+	}
+	switch p.Merge {
+	case MERGE_DEEP:
+		if baseMap, ok := base.(map[string]interface{}); ok {
+			if overlayMap, ok := overlay.(map[string]interface{}); ok {
+				return mergeMaps(baseMap, overlayMap)
+			}
+		}
+	case MERGE_APPEND, MERGE_UNION:
+		if isList(base) && isList(overlay) {
+			baseList, _ := convertValue(PARAM_LIST, base) // can't fail for lists
+			overlayList, _ := convertValue(PARAM_LIST, overlay)
+			merged := append(append([]interface{}{}, baseList.([]interface{})...), overlayList.([]interface{})...)
+			if p.Merge == MERGE_UNION {
+				merged = uniqueValues(merged)
+			}
+			return merged
+		}
+	}
+	return copyValue(overlay)
+}
+
+// Deep-merges two JSON objects into a new one following JSON Merge Patch
+// semantics: nested objects are merged recursively and a nil value in the
+// overlay removes the key.
+func mergeMaps(base map[string]interface{}, overlay map[string]interface{}) map[string]interface{} {
+	merged := copyValue(base).(map[string]interface{})
+	for key, value := range overlay {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		baseChild, baseOk := merged[key].(map[string]interface{})
+		overlayChild, overlayOk := value.(map[string]interface{})
+		if baseOk && overlayOk {
+			merged[key] = mergeMaps(baseChild, overlayChild)
+		} else if overlayOk { // replaces a non-object, still without nil values
+			merged[key] = mergeMaps(map[string]interface{}{}, overlayChild)
+		} else {
+			merged[key] = copyValue(value)
+		}
+	}
+	return merged
+}
+
+// Returns a deep copy of JSON objects and lists so merged results never share
+// (and later modify) maps or slices with Defaults or layers.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			copied[key] = copyValue(child)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, child := range v {
+			copied[i] = copyValue(child)
+		}
+		return copied
+	}
+	return value
+}
+
+func isList(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	kind := reflect.TypeOf(value).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+func uniqueValues(values []interface{}) []interface{} {
+	var unique []interface{}
+	for _, value := range values {
+		seen := false
+		for _, u := range unique {
+			if reflect.DeepEqual(u, value) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,132 @@
+package appconfig
+
+import "fmt"
+import "strings"
+
+import log "github.com/sirupsen/logrus"
+
+// Key of a config node that names the node(s) it inherits from: either a
+// string or a list of strings, each a node path like those accepted by
+// PARAM_CONFIG_NODE. The inherited nodes are merged beneath the node itself.
+const extendsKey = "extends"
+
+// Splits the value of the PARAM_CONFIG_NODE param, e.g. "common,proxy,prod",
+// into the node paths to merge from left to right.
+func splitNodeList(configNode string) []string {
+	var paths []string
+	for _, path := range strings.Split(configNode, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Selects the config nodes named by the PARAM_CONFIG_NODE value out of a
+// parsed config document and merges them from left to right, following
+// "extends" keys. Top-level keys are combined with mergeDocumentVals(), so
+// param values follow the param's Merge strategy, and a null value removes a
+// key inherited from an earlier node.
+//
+// Besides the values, returns the docPath() of each selected key in the
+// document, so the origin of the value can be looked up.
+func selectConfigNodes(doc map[string]interface{}, configNode string, configFileName string, params map[string]Param) (map[string]interface{}, map[string]string, error) {
+	paths := splitNodeList(configNode)
+	if len(paths) == 0 {
+		from := make(map[string]string, len(doc))
+		for key := range doc {
+			from[key] = docPath(key)
+		}
+		return doc, from, nil
+	}
+
+	selected := make(map[string]interface{})
+	from := make(map[string]string)
+	for _, path := range paths {
+		node, nodeFrom, err := resolveConfigNode(doc, path, configFileName, params, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		selected = mergeDocumentVals(params, selected, node)
+		for key, keyPath := range nodeFrom {
+			from[key] = keyPath
+		}
+	}
+	log.Debugf("--> Filtering JSON based on PARAM_CONFIG_NODE = '%s': %v", configNode, selected)
+	return selected, from, nil
+}
+
+// Returns a node with everything it extends merged beneath it, and the
+// docPath() each of its keys came from. chain holds the nodes currently being
+// resolved, to detect inheritance cycles.
+func resolveConfigNode(doc map[string]interface{}, path string, configFileName string, params map[string]Param, chain []string) (map[string]interface{}, map[string]string, error) {
+	for _, visiting := range chain {
+		if visiting == path {
+			return nil, nil, fmt.Errorf("Config node inheritance cycle in '%s': %s -> %s.", configFileName, strings.Join(chain, " -> "), path)
+		}
+	}
+	chain = append(chain, path)
+
+	node, keys, ok := lookupConfigNode(doc, path)
+	if !ok {
+		return nil, nil, fmt.Errorf("Node '%s' not found in JSON file '%s'.", path, configFileName)
+	}
+
+	var parents []string
+	switch extends := node[extendsKey].(type) {
+	case nil:
+	case string:
+		parents = splitNodeList(extends)
+	case []interface{}:
+		for _, parent := range extends {
+			name, ok := parent.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("Node '%s' in JSON file '%s' has a non-string '%s' entry: %v.", path, configFileName, extendsKey, parent)
+			}
+			parents = append(parents, name)
+		}
+	default:
+		return nil, nil, fmt.Errorf("Node '%s' in JSON file '%s' has an invalid '%s' value: %v.", path, configFileName, extendsKey, extends)
+	}
+
+	resolved := make(map[string]interface{})
+	from := make(map[string]string)
+	for _, parent := range parents {
+		inherited, inheritedFrom, err := resolveConfigNode(doc, parent, configFileName, params, chain)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Debugf("--> Node '%s' extends node '%s'", path, parent)
+		resolved = mergeDocumentVals(params, resolved, inherited)
+		for key, keyPath := range inheritedFrom {
+			from[key] = keyPath
+		}
+	}
+
+	own := make(map[string]interface{}, len(node))
+	for key, value := range node {
+		if key != extendsKey {
+			own[key] = value
+			from[key] = docPath(append(keys, key)...)
+		}
+	}
+	return mergeDocumentVals(params, resolved, own), from, nil
+}
+
+// Finds a node by name or, failing that, by dotted path (e.g. "apps.proxy").
+// Also returns the keys leading to the node.
+func lookupConfigNode(doc map[string]interface{}, path string) (map[string]interface{}, []string, bool) {
+	if node, ok := doc[path].(map[string]interface{}); ok {
+		return node, []string{path}, true
+	}
+	keys := strings.Split(path, ".")
+	current := doc
+	for _, name := range keys {
+		next, ok := current[name].(map[string]interface{})
+		if !ok {
+			return nil, nil, false
+		}
+		current = next
+	}
+	return current, keys, true
+}
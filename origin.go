@@ -0,0 +1,57 @@
+package appconfig
+
+import "fmt"
+import "strings"
+
+// Names of the built-in sources of parameter values, as used in Origin.Source.
+const (
+	SOURCE_DEFAULT = "default"      // Param.Default
+	SOURCE_FILE    = "file"         // a config file (PARAM_CONFIG_JSON_FILE) or a file it includes
+	SOURCE_STDIN   = "stdin"        // JSON from standard input (PARAM_CONFIG_JSON_STDIN)
+	SOURCE_ENV     = "env"          // environmental variables
+	SOURCE_ARGS    = "command-line" // command-line arguments
+)
+
+// Origin describes where a parameter value came from. Use Config.Origin() to
+// find out which source (and which file) supplied the final value of a param.
+type Origin struct {
+	Source string // one of the SOURCE_* constants
+	File   string // the file the value was read from, if any
+	Line   int    // line of the key in File, if known (1-based)
+	Column int    // column of the key in File, if known (1-based)
+}
+
+func (o Origin) String() string {
+	var desc string
+	switch o.Source {
+	case SOURCE_FILE:
+		desc = fmt.Sprintf("config file '%s'", o.File)
+	case SOURCE_STDIN:
+		desc = "stdin (standard input)"
+	case SOURCE_ENV:
+		desc = "environment variable"
+	case SOURCE_ENV_ARGS:
+		desc = fmt.Sprintf("command-line options in environment variable '%s'", o.File)
+	default:
+		desc = o.Source
+		if o.File != "" {
+			desc = fmt.Sprintf("%s '%s'", o.Source, o.File)
+		}
+	}
+	if o.Line > 0 {
+		desc += fmt.Sprintf(" at line %d, column %d", o.Line, o.Column)
+	}
+	return desc
+}
+
+// Returns the Origin of the final value of a param. The Source of a param that
+// has no value, or was left at the zero value of its Type, is empty.
+func (c *Config) Origin(key string) Origin {
+	return c.origins[key]
+}
+
+// Identifies a value inside a config document by the keys leading to it, e.g.
+// docPath("proxy", "ProxyRules"). Keys may contain any character except NUL.
+func docPath(keys ...string) string {
+	return strings.Join(keys, "\x00")
+}
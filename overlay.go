@@ -0,0 +1,253 @@
+package appconfig
+
+import "encoding/json"
+import "fmt"
+import "io"
+import "sort"
+import "strconv"
+import "strings"
+
+import log "github.com/sirupsen/logrus"
+
+// Decodes the environmental variable or command-line values of PARAM_OBJECT
+// params that hold a JSON object or array, and of PARAM_LIST params that hold
+// a JSON array. Other values are left as strings for convertValue().
+func decodeJsonArgs(vals map[string]interface{}, params map[string]Param, origin Origin) Errors {
+	var errs Errors
+	for param, value := range vals {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		decoded, err := decodeJsonArg(params[param].Type, str)
+		if err != nil {
+			errs = append(errs, &ParamError{Param: param, Origin: origin, Value: str, Err: err})
+			delete(vals, param)
+			continue
+		}
+		vals[param] = decoded
+	}
+	return errs
+}
+
+func decodeJsonArg(paramType ParamType, value string) (interface{}, error) {
+	trimmed := strings.TrimSpace(value)
+	switch {
+	case paramType == PARAM_OBJECT && (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")),
+		paramType == PARAM_LIST && strings.HasPrefix(trimmed, "["):
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(trimmed), &decoded); err != nil {
+			return nil, fmt.Errorf("%w: invalid JSON: %v", ErrConversion, err)
+		}
+		return decoded, nil
+	}
+	return value, nil
+}
+
+// Applies the values of the PARAM_CONFIG_JSON_PATCH and PARAM_CONFIG_SET
+// params to the merged values, layer by layer from the lowest precedence, and
+// within a layer the JSON Merge Patches before the assignments. The params
+// they change take the origin of the layer the overlay came from.
+func applyOverlays(config *Config, layers []layer) Errors {
+	var errs Errors
+	overlays := []struct {
+		paramType ParamType
+		apply     func(*Config, string, Origin) Errors
+	}{{PARAM_CONFIG_JSON_PATCH, applyJsonPatches}, {PARAM_CONFIG_SET, applyAssignments}}
+	for _, l := range layers {
+		for _, overlay := range overlays {
+			keys := config.GetParamKeysByType(overlay.paramType)
+			if len(keys) == 0 {
+				continue
+			}
+			value, ok := l.vals[keys[0]].(string)
+			if !ok || value == "" || !config.params[keys[0]].allowsSource(l.originOf(keys[0]).Source) {
+				continue
+			}
+			errs = append(errs, overlay.apply(config, value, l.originOf(keys[0]))...)
+		}
+	}
+	return errs
+}
+
+// Applies a stream of JSON objects, each a JSON Merge Patch (RFC 7396) whose
+// keys are param names: null removes a param's value, objects are merged
+// into object values and anything else replaces the value.
+func applyJsonPatches(config *Config, patches string, origin Origin) Errors {
+	var errs Errors
+	decoder := json.NewDecoder(strings.NewReader(patches))
+	for {
+		var patch map[string]interface{}
+		if err := decoder.Decode(&patch); err == io.EOF {
+			break
+		} else if err != nil {
+			key := config.GetParamKeysByType(PARAM_CONFIG_JSON_PATCH)[0]
+			errs = append(errs, &ParamError{Param: key, Origin: origin, Err: fmt.Errorf("%w: invalid JSON Merge Patch: %v", ErrConversion, err)})
+			break
+		}
+		params := make([]string, 0, len(patch))
+		for param := range patch {
+			params = append(params, param)
+		}
+		sort.Strings(params)
+		for _, param := range params {
+			if err := checkOverlayParam(config, param, origin); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			value := patch[param]
+			base, baseOk := config.values[param].(map[string]interface{})
+			overlay, overlayOk := value.(map[string]interface{})
+			switch {
+			case value == nil:
+				delete(config.values, param)
+				delete(config.origins, param)
+				log.Debugf("----> Patch from %s removes %s", origin, param)
+				continue
+			case baseOk && overlayOk:
+				config.values[param] = mergeMaps(base, overlay)
+			case overlayOk: // a patch applied to a non-object drops its nulls (RFC 7396)
+				config.values[param] = mergeMaps(map[string]interface{}{}, overlay)
+			default:
+				config.values[param] = copyValue(value)
+			}
+			config.origins[param] = origin
+			log.Debugf("----> Patch from %s: %s = %v", origin, param, redact(config.Sensitive(param), config.values[param]))
+		}
+	}
+	return errs
+}
+
+// Applies "path=value" assignments, one per line. The path is a param name,
+// optionally followed by "."-separated keys (or list indexes) inside an
+// object param, e.g. "ProxyRules.api.ScriptFile". A value assigned to a whole
+// param is treated like a command-line value; a value inside an object is
+// decoded if it is valid JSON (so "8080", "true" and "null" aren't strings)
+// and a string otherwise, and null removes the key.
+func applyAssignments(config *Config, assignments string, origin Origin) Errors {
+	var errs Errors
+	for _, assignment := range strings.Split(assignments, "\n") {
+		if strings.TrimSpace(assignment) == "" {
+			continue
+		}
+		i := strings.Index(assignment, "=")
+		if i < 0 {
+			key := config.GetParamKeysByType(PARAM_CONFIG_SET)[0]
+			errs = append(errs, &ParamError{Param: key, Origin: origin, Value: assignment, Err: fmt.Errorf("%w: expected path=value", ErrConversion)})
+			continue
+		}
+		raw := assignment[i+1:]
+		param, keys := splitParamPath(config.params, assignment[:i])
+		if err := checkOverlayParam(config, param, origin); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if len(keys) == 0 {
+			value, err := decodeJsonArg(config.params[param].Type, raw)
+			if err != nil {
+				errs = append(errs, &ParamError{Param: param, Origin: origin, Value: raw, Err: err})
+				continue
+			}
+			config.values[param] = mergeValue(config.params[param], config.values[param], value)
+		} else {
+			var value interface{} = raw
+			if err := json.Unmarshal([]byte(raw), &value); err != nil {
+				value = raw
+			}
+			root := copyValue(config.values[param])
+			if root == nil && config.params[param].Type == PARAM_OBJECT {
+				root = make(map[string]interface{})
+			}
+			root, err := setValuePath(root, keys, value)
+			if err != nil {
+				errs = append(errs, &ParamError{Param: param, Origin: origin, Value: assignment, Err: err})
+				continue
+			}
+			config.values[param] = root
+		}
+		config.origins[param] = origin
+		log.Debugf("----> Assignment from %s: %s = %v", origin, param, redact(config.Sensitive(param), config.values[param]))
+	}
+	return errs
+}
+
+// Splits an assignment path into the param it names and the keys below it.
+// The longest matching param name wins, so param names may contain dots. If
+// no param matches, the first part of the path is returned as the name.
+func splitParamPath(params map[string]Param, path string) (string, []string) {
+	param := ""
+	for name := range params {
+		if (path == name || strings.HasPrefix(path, name+".")) && len(name) > len(param) {
+			param = name
+		}
+	}
+	if param == "" {
+		return strings.Split(path, ".")[0], nil
+	}
+	if path == param {
+		return param, nil
+	}
+	return param, strings.Split(path[len(param)+1:], ".")
+}
+
+// Returns an error if param can't be changed by an overlay from origin.
+func checkOverlayParam(config *Config, param string, origin Origin) error {
+	p, ok := config.params[param]
+	if !ok || p.Type < 0 {
+		var names []string
+		for _, name := range sortedKeys(config.params) {
+			if config.params[name].Type >= 0 {
+				names = append(names, name)
+			}
+		}
+		return &ParamError{Param: param, Origin: origin, Err: suggest(param, names)}
+	}
+	if !p.allowsSource(origin.Source) {
+		return &ParamError{Param: param, Origin: origin, Err: fmt.Errorf("%w; allowed: %s", ErrSource, strings.Join(p.Sources, ", "))}
+	}
+	return nil
+}
+
+// Sets the value at keys inside node (an object or list), creating objects
+// along the way, and returns the node. A nil value removes an object key.
+func setValuePath(node interface{}, keys []string, value interface{}) (interface{}, error) {
+	key := keys[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(keys) == 1 {
+			if value == nil {
+				delete(n, key)
+			} else {
+				n[key] = value
+			}
+			return n, nil
+		}
+		child := n[key]
+		if child == nil {
+			child = make(map[string]interface{})
+		}
+		child, err := setValuePath(child, keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[key] = child
+		return n, nil
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(n) {
+			return nil, fmt.Errorf("%w: '%s' is not an index of a list of %d items", ErrConversion, key, len(n))
+		}
+		if len(keys) == 1 {
+			n[i] = value
+			return n, nil
+		}
+		child, err := setValuePath(n[i], keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+	return nil, fmt.Errorf("%w: cannot set '%s' inside a value that isn't an object or list", ErrConversion, key)
+}
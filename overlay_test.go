@@ -0,0 +1,29 @@
+package appconfig
+
+import "reflect"
+import "testing"
+
+func TestApplyJsonPatches(t *testing.T) {
+	config := &Config{
+		params: map[string]Param{"rules": {Type: PARAM_OBJECT}, "name": {}, "tags": {Type: PARAM_LIST}},
+		values: map[string]interface{}{
+			"rules": map[string]interface{}{"api": map[string]interface{}{"port": 80.0, "host": "a"}, "old": "x", "scalar": 1.0},
+			"name":  "app",
+			"tags":  []interface{}{"a"},
+		},
+		origins:   make(map[string]Origin),
+		sensitive: make(map[string]bool),
+	}
+	patches := `{"rules": {"api": {"host": null, "tls": true}, "old": null, "scalar": {"a": 1, "b": null}}, "name": {"first": "x", "last": null}}
+{"tags": null}`
+	if errs := applyJsonPatches(config, patches, Origin{Source: SOURCE_ARGS}); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	want := map[string]interface{}{
+		"rules": map[string]interface{}{"api": map[string]interface{}{"port": 80.0, "tls": true}, "scalar": map[string]interface{}{"a": 1.0}},
+		"name":  map[string]interface{}{"first": "x"},
+	}
+	if !reflect.DeepEqual(config.values, want) {
+		t.Errorf("got %v, want %v", config.values, want)
+	}
+}
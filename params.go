@@ -0,0 +1,207 @@
+package appconfig
+
+import "fmt"
+import "reflect"
+import "strings"
+
+var paramTypeNames = map[ParamType]string{
+	PARAM_STRING:            "PARAM_STRING",
+	PARAM_INT:               "PARAM_INT",
+	PARAM_BOOL:              "PARAM_BOOL",
+	PARAM_OBJECT:            "PARAM_OBJECT",
+	PARAM_LIST:              "PARAM_LIST",
+	PARAM_PATH:              "PARAM_PATH",
+	PARAM_CONFIG_READ_ENV:   "PARAM_CONFIG_READ_ENV",
+	PARAM_CONFIG_JSON_FILE:  "PARAM_CONFIG_JSON_FILE",
+	PARAM_CONFIG_JSON_STDIN: "PARAM_CONFIG_JSON_STDIN",
+	PARAM_CONFIG_NODE:       "PARAM_CONFIG_NODE",
+	PARAM_USAGE:             "PARAM_USAGE",
+	PARAM_CONFIG_SET:        "PARAM_CONFIG_SET",
+	PARAM_CONFIG_JSON_PATCH: "PARAM_CONFIG_JSON_PATCH",
+}
+
+// ValidateParams checks the parameter definitions themselves (not the values
+// supplied for them) and reports every mistake it finds:
+//   - a Type that isn't one of the PARAM_* constants
+//   - a Default whose Go type contradicts Type
+//   - a Required param that also has a Default (the requirement can never fail)
+//   - more than one param of the same PARAM_CONFIG_*/PARAM_USAGE type, of which only the first would be used
+//   - names or PrefixOverride choices that make two command-line switches ambiguous
+//   - a Merge strategy that doesn't apply to the param Type
+//   - Aliases that are empty or clash with another param name or alias
+//   - RequiredIf, ConflictsWith, ExactlyOneOf or AtLeastOneOf naming params that don't exist
+//
+// The returned error is of type Errors containing one *DefinitionError per
+// problem, or nil if the definitions are sound. NewConfig() calls this before
+// reading any values.
+func ValidateParams(params map[string]Param) error {
+	var errs Errors
+	fail := func(param string, format string, a ...interface{}) {
+		errs = append(errs, &DefinitionError{Param: param, Reason: fmt.Sprintf(format, a...)})
+	}
+
+	specialParams := make(map[ParamType]string) // first param seen for each negative ParamType
+	switches := make(map[string]string)         // command-line switch -> param
+	for _, param := range sortedKeys(params) {
+		p := params[param]
+
+		if param == "" {
+			fail(param, "name is empty")
+		} else if strings.Contains(param, "=") {
+			fail(param, "name contains '=', which is used to separate switches from values")
+		}
+
+		if _, ok := paramTypeNames[p.Type]; !ok {
+			fail(param, "unknown Type %d", p.Type)
+		} else if _, isString := p.Default.(string); p.Default != nil && !defaultMatchesType(p.Type, p.Default) && !(p.Interpolate && isString) { // an interpolated string is converted afterwards
+			fail(param, "Default %v is of type %s but Type is %s", p.Default, reflect.TypeOf(p.Default), paramTypeNames[p.Type])
+		}
+
+		switch p.Merge {
+		case MERGE_REPLACE:
+		case MERGE_DEEP:
+			if p.Type != PARAM_OBJECT {
+				fail(param, "Merge MERGE_DEEP only applies to Type PARAM_OBJECT")
+			}
+		case MERGE_APPEND, MERGE_UNION:
+			if p.Type != PARAM_OBJECT && p.Type != PARAM_LIST {
+				fail(param, "Merge MERGE_APPEND and MERGE_UNION only apply to Types PARAM_LIST and PARAM_OBJECT")
+			}
+		default:
+			fail(param, "unknown Merge %d", p.Merge)
+		}
+
+		if p.Required && p.Default != nil {
+			fail(param, "Required is set but so is Default, so the requirement can never fail")
+		}
+
+		if p.Type < 0 {
+			if first, ok := specialParams[p.Type]; ok {
+				fail(param, "'%s' is already of Type %s and only the first such param is used", first, paramTypeNames[p.Type])
+			} else {
+				specialParams[p.Type] = param
+			}
+		}
+
+		for _, refs := range []struct {
+			field  string
+			others []string
+		}{{"RequiredIf", p.RequiredIf}, {"ConflictsWith", p.ConflictsWith}, {"ExactlyOneOf", p.ExactlyOneOf}, {"AtLeastOneOf", p.AtLeastOneOf}} {
+			for _, other := range refs.others {
+				if _, ok := params[other]; !ok {
+					fail(param, "%s refers to undefined param '%s'", refs.field, other)
+				} else if other == param && (refs.field == "RequiredIf" || refs.field == "ConflictsWith") {
+					fail(param, "%s refers to the param itself", refs.field)
+				}
+			}
+		}
+
+		sw := paramPrefix(p) + param
+		if other, ok := switches[sw]; ok {
+			fail(param, "switch '%s' is also the switch of param '%s'", sw, other)
+		} else {
+			switches[sw] = param
+		}
+	}
+
+	// Aliases are accepted wherever the param name is, so they must be as
+	// unambiguous as the names themselves.
+	names := make(map[string]string) // name or alias -> param
+	for param := range params {
+		names[param] = param
+	}
+	for _, param := range sortedKeys(params) {
+		p := params[param]
+		for _, alias := range p.Aliases {
+			if alias.Name == "" {
+				fail(param, "has an alias with an empty name")
+				continue
+			}
+			if other, ok := names[alias.Name]; ok {
+				fail(param, "alias '%s' is also the name or an alias of param '%s'", alias.Name, other)
+				continue
+			}
+			names[alias.Name] = param
+			sw := paramPrefix(p) + alias.Name
+			if other, ok := switches[sw]; ok {
+				fail(param, "switch '%s' of alias '%s' is also the switch of param '%s'", sw, alias.Name, other)
+			} else {
+				switches[sw] = param
+			}
+		}
+	}
+
+	// processCommandLine() strips the prefix with strings.TrimPrefix, so an
+	// argument without the prefix matches the bare name as well. A bare name
+	// that equals another param's switch is therefore ambiguous.
+	for _, param := range sortedKeys(params) {
+		if other, ok := switches[param]; ok && other != param {
+			fail(param, "name is identical to the switch '%s' of param '%s'", param, other)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Names of the sources built into this package, which Param.Sources may
+// name besides those of Options.Sources.
+var builtinSourceNames = []string{SOURCE_DEFAULT, SOURCE_FILE, SOURCE_STDIN, SOURCE_ENV, SOURCE_ENV_ARGS, SOURCE_ARGS, SOURCE_HTTP, SOURCE_CONSUL, SOURCE_ETCD, SOURCE_VAULT, SOURCE_EXEC, SOURCE_DIR}
+
+// Checks that Param.Sources only names known sources, so that a typo such as
+// "commandline" doesn't leave a param accepting no source at all. Like
+// ValidateParams(), returns Errors of *DefinitionError or nil.
+func validateParamSources(params map[string]Param, extras []SourceAt) error {
+	known := make(map[string]bool)
+	for _, name := range builtinSourceNames {
+		known[name] = true
+	}
+	for _, extra := range extras {
+		if extra.Source != nil {
+			known[extra.Source.Name()] = true
+		}
+	}
+
+	var errs Errors
+	for _, param := range sortedKeys(params) {
+		for _, name := range params[param].Sources {
+			if !known[name] {
+				errs = append(errs, &DefinitionError{Param: param, Reason: fmt.Sprintf("Sources names unknown source '%s'", name)})
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Reports whether a Default value is consistent with the param Type. PARAM_STRING
+// is the zero value of ParamType (i.e., Type was omitted) and PARAM_OBJECT
+// accepts any unmarshalled JSON, so neither is checked.
+func defaultMatchesType(paramType ParamType, def interface{}) bool {
+	switch paramType {
+	case PARAM_INT:
+		_, ok := def.(int)
+		return ok
+	case PARAM_BOOL, PARAM_USAGE, PARAM_CONFIG_JSON_STDIN, PARAM_CONFIG_READ_ENV:
+		_, ok := def.(bool)
+		return ok
+	case PARAM_PATH, PARAM_CONFIG_JSON_FILE, PARAM_CONFIG_NODE, PARAM_CONFIG_SET, PARAM_CONFIG_JSON_PATCH:
+		_, ok := def.(string)
+		return ok
+	case PARAM_LIST:
+		return isList(def)
+	}
+	return true
+}
+
+// Returns the command-line switch prefix of a param, honoring PrefixOverride.
+func paramPrefix(p Param) string {
+	if p.PrefixOverride != "" {
+		return p.PrefixOverride
+	}
+	return default_prefix
+}
@@ -0,0 +1,31 @@
+package appconfig
+
+import "context"
+import "errors"
+import "testing"
+
+type namedSource string
+
+func (s namedSource) Name() string                            { return string(s) }
+func (s namedSource) Load(ctx context.Context) (*Tree, error) { return nil, nil }
+
+func TestValidateParamSources(t *testing.T) {
+	params := map[string]Param{
+		"port":     {Sources: []string{SOURCE_FILE, SOURCE_ARGS, SOURCE_ENV_ARGS}},
+		"password": {Sources: []string{SOURCE_VAULT, "keyring"}},
+	}
+	if err := validateParamSources(params, []SourceAt{{Source: namedSource("keyring")}}); err != nil {
+		t.Errorf("got %v for known sources", err)
+	}
+
+	params["typo"] = Param{Sources: []string{"commandline"}}
+	err := validateParamSources(params, nil)
+	var all Errors
+	if !errors.As(err, &all) || len(all) != 2 {
+		t.Fatalf("got %v, want errors for 'keyring' and 'commandline'", err)
+	}
+	var definitionErr *DefinitionError
+	if !errors.As(all[1], &definitionErr) || definitionErr.Param != "typo" {
+		t.Errorf("got %v, want a DefinitionError for param 'typo'", all[1])
+	}
+}
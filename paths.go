@@ -0,0 +1,53 @@
+package appconfig
+
+import "fmt"
+import "os"
+import "os/user"
+import "path/filepath"
+import "strings"
+
+// Expands a leading "~" or "~user" and environmental variables ($VAR or
+// ${VAR}) in a PARAM_PATH value, then makes it absolute. A relative path is
+// resolved against the directory of the config file that supplied it (or the
+// included file, if the value came from an "include") or of the DirSource
+// directory, and against the working directory if it came from anywhere else
+// (default, stdin, environmental variables, command-line, remote sources,
+// whose Origin.File is a URL, key or command rather than a file). An empty
+// path stays empty.
+func resolvePath(path string, origin Origin) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+
+	path = os.ExpandEnv(path)
+	if strings.HasPrefix(path, "~") {
+		name, rest := path[1:], ""
+		if i := strings.IndexRune(path, filepath.Separator); i >= 0 {
+			name, rest = path[1:i], path[i:]
+		}
+		var home string
+		if name == "" {
+			dir, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("%w: cannot expand '~': %v", ErrConversion, err)
+			}
+			home = dir
+		} else {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", fmt.Errorf("%w: cannot expand '~%s': %v", ErrConversion, name, err)
+			}
+			home = u.HomeDir
+		}
+		path = home + rest
+	}
+
+	if !filepath.IsAbs(path) && origin.File != "" && (origin.Source == SOURCE_FILE || origin.Source == SOURCE_DIR) {
+		path = filepath.Join(filepath.Dir(origin.File), path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: cannot resolve '%s': %v", ErrConversion, path, err)
+	}
+	return abs, nil
+}
@@ -0,0 +1,151 @@
+package appconfig
+
+import "os"
+import "path/filepath"
+import "strings"
+
+import log "github.com/sirupsen/logrus"
+
+// DefaultSearchPaths returns the directories in which config files of the app
+// named appName are looked up when Options.AppName is set, in decreasing
+// priority:
+//   - the working directory (project level)
+//   - $XDG_CONFIG_HOME/<appName>, or ~/.config/<appName> (user level)
+//   - each $XDG_CONFIG_DIRS/<appName>, or /etc/xdg/<appName> (system level)
+//   - /etc/<appName> (system level)
+//   - the directory of the executable
+//
+// A directory that is also an earlier entry (e.g. an executable installed in
+// /etc/<appName>) is only returned once.
+func DefaultSearchPaths(appName string) []string {
+	paths := []string{"."}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, appName))
+	}
+
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	for _, dir := range filepath.SplitList(configDirs) {
+		if dir != "" {
+			paths = append(paths, filepath.Join(dir, appName))
+		}
+	}
+
+	paths = append(paths, filepath.Join("/etc", appName))
+
+	if exe, err := os.Executable(); err == nil {
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+		paths = append(paths, filepath.Dir(exe))
+	}
+	return uniquePaths(paths)
+}
+
+// Drops directories that are the same as an earlier one once cleaned and with
+// symbolic links resolved, so their config files aren't read and merged twice.
+func uniquePaths(paths []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, path := range paths {
+		key, err := filepath.Abs(path)
+		if err != nil {
+			key = filepath.Clean(path)
+		}
+		if resolved, err := filepath.EvalSymlinks(key); err == nil {
+			key = resolved
+		}
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, path)
+		}
+	}
+	return unique
+}
+
+// Returns the directories config files are looked up in, if any.
+func (opts Options) searchPaths() []string {
+	if opts.SearchPaths != nil {
+		return uniquePaths(opts.SearchPaths)
+	}
+	if opts.AppName != "" {
+		return DefaultSearchPaths(opts.AppName)
+	}
+	return nil
+}
+
+// Looks up each relative entry of a PARAM_CONFIG_JSON_FILE value in the search
+// paths and returns the value with the entries replaced by the file(s) found.
+// An entry without an extension also matches the entry plus any of the
+// configFileExtensions. Absolute entries and globs are left alone; entries
+// found nowhere are dropped, since discovered config files are optional.
+//
+// Normally only the file in the first search path that has one is used. With
+// merge, the files in all search paths are used, lowest priority first, so that
+// e.g. a project level file overrides a user level file, which overrides a
+// system level file.
+func searchConfigFiles(value string, searchPaths []string, merge bool) string {
+	var files []string
+	for _, entry := range filepath.SplitList(value) {
+		if entry == "" || filepath.IsAbs(entry) || strings.ContainsAny(entry, "*?[") {
+			files = append(files, entry)
+			continue
+		}
+
+		var found []string
+		for _, dir := range searchPaths {
+			file := findConfigFile(filepath.Join(dir, entry))
+			if file == "" {
+				continue
+			}
+			log.Debugf("--> Found config file '%s' in search path '%s'", file, dir)
+			found = append(found, file)
+			if !merge {
+				break
+			}
+		}
+		if len(found) == 0 {
+			log.Debugf("--> Config file '%s' not found in search paths %v", entry, searchPaths)
+			continue
+		}
+		for i := len(found) - 1; i >= 0; i-- {
+			log.Infof("Using config file '%s'.", found[i])
+			files = append(files, found[i])
+		}
+	}
+	return strings.Join(files, string(os.PathListSeparator))
+}
+
+// Returns the path itself if it exists, otherwise the path plus the first of
+// the configFileExtensions for which a file exists (if path has no extension),
+// or "".
+func findConfigFile(path string) string {
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	if filepath.Ext(path) != "" {
+		return ""
+	}
+	for _, ext := range configFileExtensions {
+		if info, err := os.Stat(path + ext); err == nil && !info.IsDir() {
+			return path + ext
+		}
+	}
+	return ""
+}
+
+// ConfigFiles returns the config files that were read, in the order they were
+// merged (including files found through Options.SearchPaths, but not files
+// pulled in with "include").
+func (c *Config) ConfigFiles() []string {
+	return c.files
+}
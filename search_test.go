@@ -0,0 +1,24 @@
+package appconfig
+
+import "os"
+import "path/filepath"
+import "reflect"
+import "testing"
+
+func TestUniquePaths(t *testing.T) {
+	dir := t.TempDir()
+	etc := filepath.Join(dir, "etc", "myapp")
+	if err := os.MkdirAll(etc, 0700); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "bin")
+	if err := os.Symlink(etc, link); err != nil {
+		t.Skip("cannot create symbolic links:", err)
+	}
+
+	paths := []string{".", etc, filepath.Join(dir, "home"), etc + "/", filepath.Join(dir, "etc", ".", "myapp"), link}
+	want := []string{".", etc, filepath.Join(dir, "home")}
+	if got := uniquePaths(paths); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+package appconfig
+
+import "fmt"
+import "strings"
+
+// Shown instead of the value of a sensitive param in logs, errors, usage and
+// ToJson().
+const redacted = "<redacted>"
+
+// Sensitive reports whether the value of a param is a secret: its Param is
+// marked Sensitive, or its value came from a source that marks its values
+// sensitive (see Tree.Sensitive), such as VaultSource.
+func (c *Config) Sensitive(key string) bool {
+	return c.params[key].Sensitive || c.sensitive[key]
+}
+
+// Returns value, or a placeholder if it is sensitive.
+func redact(sensitive bool, value interface{}) interface{} {
+	if sensitive {
+		return redacted
+	}
+	return value
+}
+
+// Returns a copy of values (by param) with the sensitive ones redacted, for
+// logging.
+func (c *Config) redactedValues(values map[string]interface{}) map[string]interface{} {
+	safe := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		safe[key] = redact(c.Sensitive(key), value)
+	}
+	return safe
+}
+
+// Same as redactedValues() for values read from the command-line or
+// environmental variables.
+func redactedStrings(params map[string]Param, values map[string]string) map[string]string {
+	safe := make(map[string]string, len(values))
+	for key, value := range values {
+		safe[key] = redact(params[key].Sensitive, value).(string)
+	}
+	return safe
+}
+
+// Redacts the values of sensitive params in errors, including where the
+// underlying error quotes the value (e.g. "'x' is not an int").
+func (c *Config) redactErrors(errs Errors) {
+	for _, err := range errs {
+		if paramErr, ok := err.(*ParamError); ok && c.Sensitive(paramErr.Param) && paramErr.Value != redacted {
+			if value := fmt.Sprint(paramErr.Value); value != "" && paramErr.Err != nil {
+				paramErr.Err = &redactedError{err: paramErr.Err, value: value}
+			}
+			paramErr.Value = redacted
+		}
+	}
+}
+
+// An error whose message had a secret replaced by a placeholder.
+type redactedError struct {
+	err   error
+	value string
+}
+
+func (e *redactedError) Error() string {
+	return strings.Replace(e.err.Error(), e.value, redacted, -1)
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,563 @@
+package appconfig
+
+import "bytes"
+import "context"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "os"
+import "strings"
+import "sync"
+import "time"
+
+import log "github.com/sirupsen/logrus"
+
+// A Source supplies parameter values to NewConfigWithOptions(). The built-in
+// handling of config files, stdin, environmental variables and the
+// command-line are sources named SOURCE_FILE, SOURCE_STDIN, SOURCE_ENV,
+// SOURCE_ENV_ARGS (only with Options.ArgsEnvVar) and SOURCE_ARGS; further
+// sources are registered with Options.Sources.
+//
+// Load is called once per NewConfigWithOptions() (and again on every reload,
+// see Config.Watch()). The values of other params, as far as they are known at
+// that point, are available to it through LookupParam(ctx, name), e.g. for a
+// token or URL that configures the source itself. A Source may return values
+// together with an error (possibly Errors) to report problems with part of
+// them; errors are collected like all other loading errors.
+type Source interface {
+	Name() string                            // Used in Origin.Source and SourceAt.After, e.g. "consul"
+	Load(ctx context.Context) (*Tree, error) // Returns the values of the source. A nil Tree means no values.
+}
+
+// A Watcher is a Source that can tell when its values have changed. Watch
+// calls changed() whenever that happens and blocks until ctx is done or
+// watching fails. See Config.Watch().
+type Watcher interface {
+	Watch(ctx context.Context, changed func()) error
+}
+
+// A Tree holds the values loaded by a Source, plus where they came from.
+//
+// Values follow the shape of decoded JSON: objects are
+// map[string]interface{}, lists []interface{}, and scalars strings, float64s
+// or bools (strings are converted to the param's Type as for environmental
+// variables). A nil value is ignored.
+type Tree struct {
+	Values    map[string]interface{}
+	Origin    Origin            // Where the values came from. An empty Origin.Source is set to the Source's Name().
+	Origins   map[string]Origin // Origins of individual keys that differ from Origin, by Path() of the key in Values
+	Document  bool              // Values is a whole config document, from which the PARAM_CONFIG_NODE node(s) are selected as for config files. Otherwise its keys are param names.
+	Sensitive bool              // The values are secrets (see Param.Sensitive).
+}
+
+// Path identifies a key in a Tree by the keys leading to it, for
+// Tree.Origins, e.g. Path("proxy", "ProxyRules").
+func Path(keys ...string) string {
+	return docPath(keys...)
+}
+
+// SourceAt registers a Source with Options.Sources.
+type SourceAt struct {
+	Source Source
+	After  string // Name of the source whose values this source overrides (and which are overridden by the next one). Empty means SOURCE_FILE.
+}
+
+type lookupKey struct{}
+
+// LookupParam returns the value of a param as far as it is known while a
+// Source is loaded: from the sources loaded before it and from the
+// environmental variables and command-line (which are always read first),
+// with the usual precedence, and falling back to the param's Default. The
+// value hasn't been converted or validated yet.
+func LookupParam(ctx context.Context, name string) (interface{}, bool) {
+	if lookup, ok := ctx.Value(lookupKey{}).(func(string) (interface{}, bool)); ok {
+		return lookup(name)
+	}
+	return nil, false
+}
+
+// Parses a JSON or YAML config document loaded by a source into a Tree, with
+// the position of every key. format is "json", "yaml" or empty, in which case
+// a document starting with "{" is taken to be JSON and anything else YAML.
+func documentTree(data []byte, format string, origin Origin) (*Tree, error) {
+	name := origin.File
+	if name == "" {
+		name = origin.String()
+	}
+	if format == "" {
+		format = "yaml"
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+			format = "json"
+		}
+	}
+
+	var vals map[string]interface{}
+	var positions map[string]position
+	var err error
+	switch format {
+	case "json":
+		vals, positions, err = parseJsonDocument(data, false)
+		if syntaxErr, ok := err.(*JsonSyntaxError); ok {
+			syntaxErr.File = name
+		}
+	case "yaml":
+		vals, positions, err = parseYamlDocument(data, name)
+	default:
+		err = fmt.Errorf("Unsupported document format '%s' of '%s'.", format, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &Tree{Values: vals, Origin: origin, Origins: make(map[string]Origin), Document: true}
+	setDocumentOrigins(tree.Origins, vals, origin, positions)
+	return tree, nil
+}
+
+// Sets the value at a path of keys in a Tree being built from a key/value
+// store, creating the objects leading to it, and records its origin. A value
+// replaces any scalar in its way (the store holds both "a" and "a/b").
+func setTreePath(tree *Tree, keys []string, value interface{}, origin Origin) {
+	vals := tree.Values
+	for i, key := range keys[:len(keys)-1] {
+		child, ok := vals[key].(map[string]interface{})
+		if !ok {
+			if vals[key] != nil {
+				log.Warnf("Value of '%s' in %s is replaced by an object.", strings.Join(keys[:i+1], "/"), origin)
+			}
+			child = make(map[string]interface{})
+			vals[key] = child
+		}
+		vals = child
+	}
+	vals[keys[len(keys)-1]] = value
+	tree.Origins[docPath(keys...)] = origin
+}
+
+// Returns the built-in sources and those of Options.Sources in increasing
+// order of precedence, or in the order of Options.Precedence if given.
+func orderSources(builtins []Source, extras []SourceAt, precedence []string) ([]Source, error) {
+	sources := append([]Source{}, builtins...)
+	placed := make(map[string]int) // number of sources already placed after each source
+	for _, extra := range extras {
+		if extra.Source == nil {
+			return nil, fmt.Errorf("Options.Sources contains a nil Source.")
+		}
+		after := extra.After
+		if after == "" {
+			after = SOURCE_FILE
+		}
+		i := indexOfSource(sources, after)
+		if i < 0 {
+			return nil, fmt.Errorf("Source '%s' cannot be placed after unknown source '%s'.", extra.Source.Name(), after)
+		}
+		i += 1 + placed[after]
+		placed[after]++
+		sources = append(sources[:i], append([]Source{extra.Source}, sources[i:]...)...)
+	}
+	if precedence == nil {
+		return sources, nil
+	}
+
+	ordered := make([]Source, 0, len(sources))
+	for _, name := range precedence {
+		i := indexOfSource(sources, name)
+		if i < 0 {
+			return nil, fmt.Errorf("Unknown source '%s' in Options.Precedence.", name)
+		}
+		if indexOfSource(ordered, name) >= 0 {
+			return nil, fmt.Errorf("Source '%s' is listed more than once in Options.Precedence.", name)
+		}
+		ordered = append(ordered, sources[i])
+	}
+	for _, source := range sources {
+		if indexOfSource(ordered, source.Name()) < 0 {
+			return nil, fmt.Errorf("Source '%s' is missing from Options.Precedence.", source.Name())
+		}
+	}
+	return ordered, nil
+}
+
+// Reports whether the param accepts values from the named source, see
+// Param.Sources.
+func (p Param) allowsSource(name string) bool {
+	if len(p.Sources) == 0 || name == SOURCE_DEFAULT {
+		return true
+	}
+	for _, allowed := range p.Sources {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+func indexOfSource(sources []Source, name string) int {
+	for i, source := range sources {
+		if source.Name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Loads the sources, lowest precedence first, into layers. Sources in
+// preloaded (environmental variables and command-line) are loaded up front,
+// so that LookupParam() sees them from every source.
+func loadSources(ctx context.Context, sources []Source, preloaded map[string]bool, configNode string, params map[string]Param, opts Options) ([]layer, Errors) {
+	var errs Errors
+	layers := make([]*layer, len(sources))
+
+	lookup := func(name string) (interface{}, bool) {
+		value, found := params[name].Default, params[name].Default != nil
+		for _, l := range layers {
+			if l != nil && l.vals[name] != nil && params[name].allowsSource(l.originOf(name).Source) {
+				value, found = l.vals[name], true
+			}
+		}
+		return value, found
+	}
+	ctx = context.WithValue(ctx, lookupKey{}, lookup)
+
+	load := func(i int) {
+		source := sources[i]
+		log.Debugf("Loading source '%s'...", source.Name())
+		tree, err := source.Load(ctx)
+		if err != nil {
+			var all Errors
+			if errors.As(err, &all) {
+				errs = append(errs, all...)
+			} else {
+				errs = append(errs, err)
+			}
+		}
+		if tree == nil {
+			return
+		}
+		l, err := treeLayer(tree, source.Name(), configNode, params)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		errs = append(errs, resolveAliases(l, params, opts.Version)...)
+		errs = append(errs, checkUnknownKeys(opts.Strict, unknownLayerKeys(l, params))...)
+		layers[i] = &l
+	}
+	for i, source := range sources {
+		if preloaded[source.Name()] {
+			load(i)
+		}
+	}
+	for i, source := range sources {
+		if !preloaded[source.Name()] {
+			load(i)
+		}
+	}
+
+	var loaded []layer
+	for _, l := range layers {
+		if l != nil {
+			loaded = append(loaded, *l)
+		}
+	}
+	return loaded, errs
+}
+
+// Turns the Tree loaded by a source into a layer, selecting the config nodes
+// if it is a document.
+func treeLayer(tree *Tree, name string, configNode string, params map[string]Param) (layer, error) {
+	origin := tree.Origin
+	if origin.Source == "" {
+		origin.Source = name
+	}
+	origins := make(map[string]Origin, len(tree.Origins))
+	for path, o := range tree.Origins {
+		if o.Source == "" {
+			o.Source = name
+		}
+		origins[path] = o
+	}
+	vals := tree.Values
+	if vals == nil {
+		vals = make(map[string]interface{})
+	}
+
+	if tree.Document {
+		l, err := documentLayer(configDocument{vals: vals, origins: origins}, origin, configNode, params)
+		l.sensitive = tree.Sensitive
+		return l, err
+	}
+	l := layer{origin: origin, origins: make(map[string]Origin), vals: vals, sensitive: tree.Sensitive}
+	for key := range vals {
+		if o, ok := origins[docPath(key)]; ok {
+			l.origins[key] = o
+		}
+	}
+	return l, nil
+}
+
+// The config files named by the PARAM_CONFIG_JSON_FILE param (SOURCE_FILE).
+// Each file's config node(s) are selected and the files are merged in order.
+// Problems with config files (missing files, syntax errors, missing nodes)
+// are collected like any other error; the files affected are skipped.
+//
+// Watch() notices when one of the files is added, removed or modified, but not
+// the files they include.
+type fileSource struct {
+	config     *Config
+	configJson string
+	configNode string
+
+	mu      sync.Mutex
+	version string // names, sizes and modification times of the files last loaded
+}
+
+func (s *fileSource) Name() string {
+	return SOURCE_FILE
+}
+
+func (s *fileSource) Load(ctx context.Context) (*Tree, error) {
+	params, opts := s.config.params, s.config.opts
+	s.mu.Lock()
+	s.version = configFilesVersion(s.configJson)
+	s.mu.Unlock()
+	var errs Errors
+	configFiles, err := expandConfigFiles(s.configJson)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(configFiles) == 0 {
+		log.Debugf("No configuration file specified.")
+	}
+
+	tree := &Tree{Values: make(map[string]interface{}), Origin: Origin{Source: SOURCE_FILE}, Origins: make(map[string]Origin)}
+	for _, configFile := range configFiles {
+		log.Debugf("Reading config file: file = '%s', node = '%s'", configFile, s.configNode)
+
+		doc, err := loadConfigFile(configFile, params, opts, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		configFileLayer, err := documentLayer(doc, Origin{Source: SOURCE_FILE, File: configFile}, s.configNode, params)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, resolveAliases(configFileLayer, params, opts.Version)...)
+		for key, val := range configFileLayer.vals {
+			if val != nil {
+				tree.Values[key] = mergeValue(params[key], tree.Values[key], val)
+				tree.Origins[docPath(key)] = configFileLayer.originOf(key)
+			}
+		}
+		s.config.files = append(s.config.files, configFile)
+	}
+	if len(errs) > 0 {
+		return tree, errs
+	}
+	return tree, nil
+}
+
+// Watch checks the config files every Options.FilePollInterval and calls
+// changed() when they differ from the ones last loaded.
+func (s *fileSource) Watch(ctx context.Context, changed func()) error {
+	interval := s.config.opts.FilePollInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current := configFilesVersion(s.configJson)
+		s.mu.Lock()
+		version := s.version
+		s.version = current
+		s.mu.Unlock()
+		if current != version {
+			log.Infof("Config files '%s' have changed.", s.configJson)
+			changed()
+		}
+	}
+}
+
+// Identifies the config files named by configJson (see expandConfigFiles()):
+// their names, sizes and modification times.
+func configFilesVersion(configJson string) string {
+	configFiles, _ := expandConfigFiles(configJson)
+	var files []string
+	for _, file := range configFiles {
+		info, err := os.Stat(file)
+		if err != nil {
+			files = append(files, file+":missing")
+			continue
+		}
+		files = append(files, fmt.Sprintf("%s:%d:%d", file, info.Size(), info.ModTime().UnixNano()))
+	}
+	return strings.Join(files, "\n")
+}
+
+// JSON from stdin, if the PARAM_CONFIG_JSON_STDIN param is set (SOURCE_STDIN).
+type stdinSource struct {
+	config *Config
+	read   bool
+	input  *configInput // keeps what was read from stdin for reloads
+}
+
+func (s *stdinSource) Name() string {
+	return SOURCE_STDIN
+}
+
+func (s *stdinSource) Load(ctx context.Context) (*Tree, error) {
+	if !s.read {
+		return nil, nil
+	}
+	data, err := s.input.readStdin()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := loadConfigDocument(bytes.NewReader(data), "stdin (standard input)", ".", Origin{Source: SOURCE_STDIN}, s.config.params, s.config.opts, nil) //ConfigJson from stdin
+	if err != nil {
+		return nil, err
+	}
+	return &Tree{Values: doc.vals, Origin: Origin{Source: SOURCE_STDIN}, Origins: doc.origins, Document: true}, nil
+}
+
+// Environmental variables (SOURCE_ENV) or command-line arguments
+// (SOURCE_ARGS, or SOURCE_ENV_ARGS from Options.ArgsEnvVar), which are read
+// before any source is loaded.
+type stringSource struct {
+	name   string
+	file   string // Origin.File, e.g. the name of Options.ArgsEnvVar
+	vals   map[string]string
+	params map[string]Param // to decode JSON values of PARAM_OBJECT and PARAM_LIST params
+}
+
+func (s *stringSource) Name() string {
+	return s.name
+}
+
+func (s *stringSource) Load(ctx context.Context) (*Tree, error) {
+	tree := &Tree{Values: stringVals(s.vals), Origin: Origin{Source: s.name, File: s.file}}
+	if errs := decodeJsonArgs(tree.Values, s.params, tree.Origin); len(errs) > 0 {
+		return tree, errs
+	}
+	return tree, nil
+}
+
+// Watch calls onReload with a freshly loaded Config (and its error, if any)
+// whenever a source that is a Watcher, or one of the config files, reports a
+// change. It blocks until ctx is done and returns ctx.Err(), or returns an
+// error right away if none of the sources can be watched. Changes reported
+// while a reload is running cause one more reload afterwards.
+//
+// Reloads reuse the command-line, Options.ArgsEnvVar and stdin as read by
+// NewConfigWithOptions(), and report all problems through onReload instead of
+// exiting.
+func (c *Config) Watch(ctx context.Context, onReload func(Config, error)) error {
+	var watchers []Watcher
+	var names []string
+	for _, source := range c.sources {
+		if files, ok := source.(*fileSource); ok && files.configJson == "" {
+			continue // no config files to watch
+		}
+		if watcher, ok := source.(Watcher); ok {
+			watchers = append(watchers, watcher)
+			names = append(names, source.Name())
+		}
+	}
+	if len(watchers) == 0 {
+		return fmt.Errorf("None of the configuration sources can be watched.")
+	}
+	log.Debugf("Watching sources: %s", strings.Join(names, ", "))
+
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default: // a reload is already pending
+		}
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i, watcher := range watchers {
+		wg.Add(1)
+		go func(name string, watcher Watcher) {
+			defer wg.Done()
+			if err := watcher.Watch(ctx, notify); err != nil && ctx.Err() == nil {
+				log.WithFields(log.Fields{"err": err}).Errorf("Stopped watching source '%s'.", name)
+			}
+		}(names[i], watcher)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+			log.Debugf("Source changed, reloading configuration...")
+			config, err := loadConfig(c.params, c.opts, c.input)
+			onReload(config, err)
+		}
+	}
+}
+
+// Splits a key of a key/value store into the keys of a Tree path, relative to
+// the prefix. Returns nil for the prefix itself and for keys outside it.
+func splitStoreKey(key string, prefix string) []string {
+	key = strings.Trim(key, "/")
+	if prefix != "" {
+		if !strings.HasPrefix(key, prefix+"/") {
+			return nil
+		}
+		key = key[len(prefix)+1:]
+	}
+	var keys []string
+	for _, part := range strings.Split(key, "/") {
+		if part != "" {
+			keys = append(keys, part)
+		}
+	}
+	return keys
+}
+
+// Returns the value of a param as a string while a Source is loaded, or "" if
+// there's none (or name is "").
+func lookupString(ctx context.Context, name string) string {
+	if name == "" {
+		return ""
+	}
+	if value, ok := LookupParam(ctx, name); ok && value != nil {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
+
+// Sleeps for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// Decodes a value of a key/value store: a JSON object or array becomes the
+// corresponding map or list, anything else a string.
+func decodeStoreValue(raw []byte) interface{} {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		var value interface{}
+		if err := json.Unmarshal(trimmed, &value); err == nil {
+			return value
+		}
+	}
+	return string(raw)
+}
@@ -0,0 +1,144 @@
+package appconfig
+
+import "fmt"
+import "os"
+import "sort"
+import "strings"
+
+import log "github.com/sirupsen/logrus"
+
+// StrictMode is an optional property of Options that determines what happens
+// to keys in the selected config node(s) and to Options.EnvPrefix
+// environmental variables that don't correspond to any param (e.g. a typo like
+// "statsd_adr"). Each such key is reported with the closest param name as a
+// suggestion.
+type StrictMode int
+
+// Constants for the StrictMode type.
+const (
+	STRICT_OFF   StrictMode = iota // Unknown keys are ignored. This is the default.
+	STRICT_WARN                    // Unknown keys are logged as warnings.
+	STRICT_ERROR                   // Unknown keys are errors wrapping ErrUnknown.
+)
+
+// Applies the StrictMode to the unknown keys found in a source.
+func checkUnknownKeys(mode StrictMode, unknown Errors) Errors {
+	switch mode {
+	case STRICT_WARN:
+		for _, err := range unknown {
+			log.Warn(err)
+		}
+	case STRICT_ERROR:
+		return unknown
+	}
+	return nil
+}
+
+// Returns an error for each key of a config file layer that isn't a param.
+// Aliases have already been mapped onto their params by resolveAliases().
+func unknownLayerKeys(l layer, params map[string]Param) Errors {
+	var keys []string
+	for key := range l.vals {
+		if _, ok := params[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var errs Errors
+	for _, key := range keys {
+		errs = append(errs, &ParamError{Param: key, Origin: l.originOf(key), Value: redact(l.sensitive, l.vals[key]), Err: unknownKeyError(key, params)})
+	}
+	return errs
+}
+
+// Returns an error for each environmental variable starting with
+// Options.EnvPrefix that isn't named after a param or an alias, nor is the
+// Options.ArgsEnvVar.
+func unknownEnvVars(params map[string]Param, opts Options) Errors {
+	prefix := opts.EnvPrefix
+	known := map[string]bool{opts.ArgsEnvVar: true}
+	var names []string
+	for _, param := range sortedKeys(params) {
+		p := params[param]
+		known[envVarName(param, prefix)] = true
+		names = append(names, envVarName(param, prefix))
+		for _, alias := range p.Aliases {
+			known[envVarName(alias.Name, prefix)] = true
+		}
+	}
+
+	environ := os.Environ()
+	sort.Strings(environ)
+
+	var errs Errors
+	for _, env := range environ {
+		name := strings.SplitN(env, "=", 2)[0]
+		if !strings.HasPrefix(name, prefix) || known[name] {
+			continue
+		}
+		// The value is left out: a mistyped name may hold a secret
+		errs = append(errs, &ParamError{Param: name, Origin: Origin{Source: SOURCE_ENV}, Err: suggest(name, names)})
+	}
+	return errs
+}
+
+func unknownKeyError(key string, params map[string]Param) error {
+	return suggest(key, sortedKeys(params))
+}
+
+// Returns ErrUnknown, with the closest candidate as a suggestion if any.
+func suggest(name string, candidates []string) error {
+	if suggestion := closestName(name, candidates); suggestion != "" {
+		return fmt.Errorf("%w, did you mean '%s'", ErrUnknown, suggestion)
+	}
+	return ErrUnknown
+}
+
+// Returns the environmental variable name of a param, see Options.EnvPrefix.
+func envVarName(param string, prefix string) string {
+	if prefix == "" {
+		return param
+	}
+	return prefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(param))
+}
+
+// Returns the candidate closest to name by edit distance, if it is close
+// enough to be a plausible typo, or "".
+func closestName(name string, candidates []string) string {
+	best, bestDistance := "", len(name)/3+2
+	for _, candidate := range candidates {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur := make([]int, len(br)+1)
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(br)]
+}
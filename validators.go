@@ -0,0 +1,399 @@
+package appconfig
+
+import "fmt"
+import "io"
+import "net"
+import "net/url"
+import "os"
+import "path/filepath"
+import "reflect"
+import "regexp"
+import "strconv"
+import "strings"
+
+// A Rule is a reusable check for a parameter value together with a
+// human-readable description of the constraint it enforces. Add rules to
+// Param.Rules; PrintUsage() shows their descriptions as "(must be ...)".
+//
+// The rules in this file never panic on a value of an unexpected type; they
+// return an error saying what type was expected instead. Rules compose with
+// All() and Any().
+type Rule struct {
+	Description string                  // Completes the sentence "must be ...", e.g. "between 100 and 1000"
+	Check       func(interface{}) error // Returns nil if the value satisfies the rule, otherwise an error explaining why not
+}
+
+// The value must be an integer with min <= value <= max.
+func IntRange(min, max int) Rule {
+	return intRule(fmt.Sprintf("between %d and %d", min, max), func(i int) bool { return min <= i && i <= max })
+}
+
+// The value must be an integer >= min.
+func MinInt(min int) Rule {
+	return intRule(fmt.Sprintf("at least %d", min), func(i int) bool { return i >= min })
+}
+
+// The value must be an integer <= max.
+func MaxInt(max int) Rule {
+	return intRule(fmt.Sprintf("at most %d", max), func(i int) bool { return i <= max })
+}
+
+// The value must be a number with min <= value <= max.
+func FloatRange(min, max float64) Rule {
+	desc := fmt.Sprintf("between %v and %v", min, max)
+	return Rule{Description: desc, Check: func(value interface{}) error {
+		f, err := asFloat(value)
+		if err != nil {
+			return err
+		}
+		if f < min || f > max {
+			return fmt.Errorf("%v is not %s", f, desc)
+		}
+		return nil
+	}}
+}
+
+// The value must be a string of min to max characters. A negative max means
+// there is no upper bound.
+func StringLength(min, max int) Rule {
+	desc := fmt.Sprintf("%d to %d characters long", min, max)
+	if max < 0 {
+		desc = fmt.Sprintf("at least %d characters long", min)
+	}
+	return Rule{Description: desc, Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		if n := len([]rune(s)); n < min || (max >= 0 && n > max) {
+			return fmt.Errorf("'%s' is %d characters long; must be %s", s, n, desc)
+		}
+		return nil
+	}}
+}
+
+// The value must be a string matching the regular expression pattern. Like
+// regexp.MustCompile, this panics if the pattern itself is invalid.
+func MatchRegexp(pattern string) Rule {
+	re := regexp.MustCompile(pattern)
+	desc := fmt.Sprintf("matching /%s/", pattern)
+	return Rule{Description: desc, Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(s) {
+			return fmt.Errorf("'%s' is not %s", s, desc)
+		}
+		return nil
+	}}
+}
+
+// The value must be a string equal to one of the choices.
+func OneOf(choices ...string) Rule {
+	desc := "one of: " + strings.Join(choices, ", ")
+	return Rule{Description: desc, Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		for _, choice := range choices {
+			if s == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf("'%s' is not %s", s, desc)
+	}}
+}
+
+// The value must be an absolute URL with a scheme and a host.
+func URL() Rule {
+	return Rule{Description: "a URL", Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		u, err := url.Parse(s)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("'%s' is not an absolute URL with scheme and host", s)
+		}
+		return nil
+	}}
+}
+
+// The value must be a [host]:port address with a numeric port, e.g.
+// "localhost:8125" or ":8080".
+func HostPort() Rule {
+	return Rule{Description: "a [host]:port address", Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		_, port, err := net.SplitHostPort(s)
+		if err != nil {
+			return err
+		}
+		if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+			return fmt.Errorf("'%s' does not have a port number between 0 and 65535", s)
+		}
+		return nil
+	}}
+}
+
+// The value must be an IPv4 or IPv6 address.
+func IP() Rule {
+	return Rule{Description: "an IP address", Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		if net.ParseIP(s) == nil {
+			return fmt.Errorf("'%s' is not an IP address", s)
+		}
+		return nil
+	}}
+}
+
+// The value must be a network in CIDR notation, e.g. "10.0.0.0/8".
+func CIDR() Rule {
+	return Rule{Description: "a CIDR network", Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		_, _, err = net.ParseCIDR(s)
+		return err
+	}}
+}
+
+// The value must be the path of an existing regular file.
+func ExistingFile() Rule {
+	return Rule{Description: "an existing file", Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(s)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("'%s' is not a regular file", s)
+		}
+		return nil
+	}}
+}
+
+// The value must be the path of an existing directory.
+func ExistingDir() Rule {
+	return Rule{Description: "an existing directory", Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(s)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("'%s' is not a directory", s)
+		}
+		return nil
+	}}
+}
+
+// The value must be the path of an existing file, directory or other file
+// system entry.
+func ExistingPath() Rule {
+	return Rule{Description: "an existing path", Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stat(s)
+		return err
+	}}
+}
+
+// The value must be the path of a file that can be opened for reading, or of
+// a directory that can be listed.
+func Readable() Rule {
+	return Rule{Description: "readable", Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(s)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if info, err := f.Stat(); err == nil && info.IsDir() {
+			_, err = f.Readdirnames(1)
+			if err != nil && err != io.EOF {
+				return err
+			}
+		}
+		return nil
+	}}
+}
+
+// The value must be the path of a file that can be opened for writing, or of
+// a directory in which files can be created. A file that doesn't exist yet is
+// accepted if it can be created in its directory.
+func Writable() Rule {
+	return Rule{Description: "writable", Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		dir := s
+		info, err := os.Stat(s)
+		switch {
+		case os.IsNotExist(err):
+			dir = filepath.Dir(s)
+		case err != nil:
+			return err
+		case !info.IsDir():
+			f, err := os.OpenFile(s, os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			return f.Close()
+		}
+		f, err := os.CreateTemp(dir, ".appconfig-write-check-*")
+		if err != nil {
+			return fmt.Errorf("'%s' is not writable: %v", s, err)
+		}
+		f.Close()
+		return os.Remove(f.Name())
+	}}
+}
+
+// The value must be the path of an existing regular file with an execute
+// permission bit set.
+func Executable() Rule {
+	return Rule{Description: "an executable file", Check: func(value interface{}) error {
+		s, err := asString(value)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(s)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			return fmt.Errorf("'%s' is not an executable file", s)
+		}
+		return nil
+	}}
+}
+
+// The value must be a non-empty string, list or object.
+func NonEmpty() Rule {
+	return Rule{Description: "non-empty", Check: func(value interface{}) error {
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+			if v.Len() == 0 {
+				return fmt.Errorf("value is empty")
+			}
+			return nil
+		}
+		return fmt.Errorf("expected a string, list or object, got %s", describeType(value))
+	}}
+}
+
+// The value must satisfy every one of the rules.
+func All(rules ...Rule) Rule {
+	descs := make([]string, len(rules))
+	for i, rule := range rules {
+		descs[i] = rule.Description
+	}
+	return Rule{Description: strings.Join(descs, " and "), Check: func(value interface{}) error {
+		for _, rule := range rules {
+			if err := rule.Check(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
+}
+
+// The value must satisfy at least one of the rules.
+func Any(rules ...Rule) Rule {
+	descs := make([]string, len(rules))
+	for i, rule := range rules {
+		descs[i] = rule.Description
+	}
+	desc := strings.Join(descs, " or ")
+	return Rule{Description: desc, Check: func(value interface{}) error {
+		var msgs []string
+		for _, rule := range rules {
+			err := rule.Check(value)
+			if err == nil {
+				return nil
+			}
+			msgs = append(msgs, err.Error())
+		}
+		return fmt.Errorf("must be %s (%s)", desc, strings.Join(msgs, "; "))
+	}}
+}
+
+func intRule(desc string, ok func(int) bool) Rule {
+	return Rule{Description: desc, Check: func(value interface{}) error {
+		i, err := asInt(value)
+		if err != nil {
+			return err
+		}
+		if !ok(i) {
+			return fmt.Errorf("%d is not %s", i, desc)
+		}
+		return nil
+	}}
+}
+
+func describeType(value interface{}) string {
+	if value == nil {
+		return "nothing"
+	}
+	return reflect.TypeOf(value).String()
+}
+
+func asString(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("expected a string, got %s", describeType(value))
+}
+
+func asInt(value interface{}) (int, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == float64(int(f)) {
+			return int(f), nil
+		}
+	}
+	return 0, fmt.Errorf("expected an int, got %s", describeType(value))
+}
+
+func asFloat(value interface{}) (float64, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return 0, fmt.Errorf("expected a number, got %s", describeType(value))
+}
@@ -0,0 +1,404 @@
+package appconfig
+
+import "bytes"
+import "context"
+import "encoding/json"
+import "fmt"
+import "io"
+import "net/http"
+import "os"
+import "strings"
+import "sync"
+import "time"
+
+import log "github.com/sirupsen/logrus"
+
+// Name of the VaultSource, as used in Origin.Source.
+const SOURCE_VAULT = "vault"
+
+// VaultSource is a Source that reads a secret from a HashiCorp Vault KV
+// version 2 secrets engine and maps its fields onto params. Its values are
+// sensitive (see Param.Sensitive).
+//
+// It authenticates with a token or, if there is none, by logging in with
+// AppRole. Watch() renews the token (and any lease of the secret) before it
+// expires and polls the secret's version, reporting a change when a new
+// version is written. A given token is looked up when loading to learn when
+// it expires; one that isn't renewable is left to expire.
+type VaultSource struct {
+	Address       string            // Base URL of Vault. Default is $VAULT_ADDR, or else "https://127.0.0.1:8200".
+	AddressParam  string            // Name of a param holding the address, used if Address is empty.
+	Namespace     string            // Vault Enterprise namespace, if any.
+	Mount         string            // Mount path of the KV version 2 engine. Default is "secret".
+	Path          string            // Path of the secret in the engine, e.g. "myapp/db".
+	Fields        map[string]string // Param names by secret field, e.g. {"password": "db-password"}. Empty means every field sets the param of the same name.
+	Token         string            // Token to authenticate with. Default is $VAULT_TOKEN.
+	TokenParam    string            // Name of a param holding the token, used if Token is empty.
+	RoleID        string            // AppRole role ID, used to log in if there is no token.
+	RoleIDParam   string            // Name of a param holding the role ID, used if RoleID is empty.
+	SecretID      string            // AppRole secret ID.
+	SecretIDParam string            // Name of a param holding the secret ID (e.g. "vault-secret-id"), used if SecretID is empty.
+	AppRoleMount  string            // Mount path of the AppRole auth method. Default is "approle".
+	PollInterval  time.Duration     // How often Watch() checks the secret's version. Default is 1 minute.
+	Timeout       time.Duration     // Timeout of each request. Default is 10 seconds.
+	Client        *http.Client      // Client to use instead of one with Timeout.
+
+	mu       sync.Mutex
+	address  string
+	roleID   string
+	secretID string
+	token    string        // the token in use, given or from the AppRole login
+	login    bool          // whether token came from the AppRole login (and can be renewed by logging in again)
+	expires  time.Time     // when token expires, zero if it doesn't
+	tokenTTL time.Duration // lifetime of token when it was issued or renewed
+	leaseID  string        // lease of the secret, if it has one
+	leaseEnd time.Time
+	leaseTTL time.Duration
+	version  float64 // version of the secret last read
+}
+
+// Vault's response to reads, logins and renewals.
+type vaultResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func (s *VaultSource) Name() string {
+	return SOURCE_VAULT
+}
+
+func (s *VaultSource) Load(ctx context.Context) (*Tree, error) {
+	address := s.Address
+	if address == "" {
+		address = lookupString(ctx, s.AddressParam)
+	}
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		address = "https://127.0.0.1:8200"
+	}
+	token := s.Token
+	if token == "" {
+		token = lookupString(ctx, s.TokenParam)
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	roleID := s.RoleID
+	if roleID == "" {
+		roleID = lookupString(ctx, s.RoleIDParam)
+	}
+	secretID := s.SecretID
+	if secretID == "" {
+		secretID = lookupString(ctx, s.SecretIDParam)
+	}
+
+	s.mu.Lock()
+	s.address, s.roleID, s.secretID = strings.TrimRight(address, "/"), roleID, secretID
+	if token != "" {
+		s.token, s.login = token, false
+		s.expires, s.tokenTTL = time.Time{}, 0
+	} else if !s.login { // keep a token from an earlier login
+		s.token = ""
+	}
+	s.mu.Unlock()
+	if token != "" {
+		s.lookupToken(ctx)
+	}
+
+	data, err := s.readSecret(ctx)
+	if err != nil {
+		return nil, err
+	}
+	secret, _ := data["data"].(map[string]interface{})
+	if metadata, ok := data["metadata"].(map[string]interface{}); ok {
+		version, _ := metadata["version"].(float64)
+		s.mu.Lock()
+		s.version = version
+		s.mu.Unlock()
+	}
+
+	origin := Origin{Source: SOURCE_VAULT, File: s.mount() + "/" + strings.Trim(s.Path, "/")}
+	tree := &Tree{Values: make(map[string]interface{}), Origin: origin, Sensitive: true}
+	for field, value := range secret {
+		param := field
+		if len(s.Fields) > 0 {
+			var ok bool
+			if param, ok = s.Fields[field]; !ok {
+				continue
+			}
+		}
+		tree.Values[param] = value
+	}
+	log.Debugf("--> Read %d fields of Vault secret '%s'", len(tree.Values), origin.File)
+	return tree, nil
+}
+
+// Watch renews the token and the secret's lease before they expire, and
+// polls the secret every PollInterval for a new version. Failures are logged
+// and retried.
+func (s *VaultSource) Watch(ctx context.Context, changed func()) error {
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	for ctx.Err() == nil {
+		wait := interval
+		s.mu.Lock()
+		if !s.expires.IsZero() && renewalDue(s.expires, s.tokenTTL) < wait {
+			wait = renewalDue(s.expires, s.tokenTTL)
+		}
+		if s.leaseID != "" && !s.leaseEnd.IsZero() && renewalDue(s.leaseEnd, s.leaseTTL) < wait {
+			wait = renewalDue(s.leaseEnd, s.leaseTTL)
+		}
+		s.mu.Unlock()
+		if wait < time.Second {
+			wait = time.Second
+		}
+		sleepContext(ctx, wait)
+		if ctx.Err() != nil {
+			break
+		}
+
+		if err := s.renew(ctx); err != nil {
+			log.WithFields(log.Fields{"err": err}).Warnf("Cannot renew Vault token or lease.")
+		}
+
+		s.mu.Lock()
+		version := s.version
+		s.mu.Unlock()
+		data, err := s.readSecret(ctx)
+		if err != nil {
+			log.WithFields(log.Fields{"err": err}).Warnf("Cannot poll Vault secret '%s'.", s.Path)
+			continue
+		}
+		if metadata, ok := data["metadata"].(map[string]interface{}); ok {
+			if newVersion, _ := metadata["version"].(float64); newVersion != version {
+				s.mu.Lock()
+				s.version = newVersion
+				s.mu.Unlock()
+				log.Infof("Vault secret '%s' has a new version.", s.Path)
+				changed()
+			}
+		}
+	}
+	return nil
+}
+
+// Reads the secret (the "data" of a KV version 2 read), logging in first if
+// needed, and again if the token has been revoked or has expired.
+func (s *VaultSource) readSecret(ctx context.Context) (map[string]interface{}, error) {
+	path := "/v1/" + s.mount() + "/data/" + escapeKey(strings.Trim(s.Path, "/"))
+	for attempt := 0; ; attempt++ {
+		if err := s.ensureToken(ctx); err != nil {
+			return nil, err
+		}
+		resp, status, err := s.request(ctx, http.MethodGet, path, nil)
+		if status == http.StatusForbidden && attempt == 0 && s.canLogin() {
+			s.mu.Lock()
+			s.token = ""
+			s.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read Vault secret '%s': %v", s.Path, err)
+		}
+		s.mu.Lock()
+		s.leaseID = resp.LeaseID
+		s.leaseEnd, s.leaseTTL = time.Time{}, 0
+		if resp.LeaseID != "" && resp.Renewable && resp.LeaseDuration > 0 {
+			s.leaseTTL = time.Duration(resp.LeaseDuration) * time.Second
+			s.leaseEnd = time.Now().Add(s.leaseTTL)
+		}
+		s.mu.Unlock()
+		return resp.Data, nil
+	}
+}
+
+func (s *VaultSource) canLogin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.roleID != "" && (s.login || s.token == "")
+}
+
+// Logs in with AppRole if there is no token.
+func (s *VaultSource) ensureToken(ctx context.Context) error {
+	s.mu.Lock()
+	token, roleID, secretID := s.token, s.roleID, s.secretID
+	s.mu.Unlock()
+	if token != "" {
+		return nil
+	}
+	if roleID == "" {
+		return fmt.Errorf("No Vault token or AppRole role ID for secret '%s'.", s.Path)
+	}
+
+	appRole := s.AppRoleMount
+	if appRole == "" {
+		appRole = "approle"
+	}
+	body := map[string]string{"role_id": roleID}
+	if secretID != "" {
+		body["secret_id"] = secretID
+	}
+	resp, _, err := s.request(ctx, http.MethodPost, "/v1/auth/"+strings.Trim(appRole, "/")+"/login", body)
+	if err != nil {
+		return fmt.Errorf("Cannot log in to Vault with AppRole: %v", err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return fmt.Errorf("Cannot log in to Vault with AppRole: no token in response.")
+	}
+	s.mu.Lock()
+	s.token, s.login = resp.Auth.ClientToken, true
+	s.expires, s.tokenTTL = time.Time{}, 0
+	if resp.Auth.LeaseDuration > 0 {
+		s.tokenTTL = time.Duration(resp.Auth.LeaseDuration) * time.Second
+		s.expires = time.Now().Add(s.tokenTTL)
+	}
+	s.mu.Unlock()
+	log.Debugf("--> Logged in to Vault with AppRole")
+	return nil
+}
+
+// Learns when a given token expires (lookup-self), so that it is renewed
+// like a token from an AppRole login. Failures are logged, as a token may
+// lack the permission while still being able to read the secret.
+func (s *VaultSource) lookupToken(ctx context.Context) {
+	resp, _, err := s.request(ctx, http.MethodGet, "/v1/auth/token/lookup-self", nil)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Warnf("Cannot look up Vault token, it won't be renewed.")
+		return
+	}
+	ttl, _ := resp.Data["ttl"].(float64)
+	creationTTL, _ := resp.Data["creation_ttl"].(float64)
+	if renewable, _ := resp.Data["renewable"].(bool); !renewable || ttl <= 0 {
+		log.Debugf("--> Vault token doesn't expire or can't be renewed")
+		return
+	}
+	if creationTTL < ttl {
+		creationTTL = ttl
+	}
+	s.mu.Lock()
+	s.tokenTTL = time.Duration(creationTTL) * time.Second
+	s.expires = time.Now().Add(time.Duration(ttl) * time.Second)
+	s.mu.Unlock()
+	log.Debugf("--> Vault token expires in %ds", int(ttl))
+}
+
+// Renews the token and the secret's lease if they are about to expire. A
+// token from an AppRole login that can't be renewed is replaced by logging in
+// again.
+func (s *VaultSource) renew(ctx context.Context) error {
+	s.mu.Lock()
+	expires, tokenTTL, leaseID, leaseEnd, leaseTTL, login := s.expires, s.tokenTTL, s.leaseID, s.leaseEnd, s.leaseTTL, s.login
+	s.mu.Unlock()
+
+	if !expires.IsZero() && renewalDue(expires, tokenTTL) <= time.Second {
+		resp, _, err := s.request(ctx, http.MethodPost, "/v1/auth/token/renew-self", map[string]string{})
+		if err == nil && resp.Auth != nil {
+			s.mu.Lock()
+			s.tokenTTL = time.Duration(resp.Auth.LeaseDuration) * time.Second
+			s.expires = time.Now().Add(s.tokenTTL)
+			s.mu.Unlock()
+			log.Debugf("--> Renewed Vault token")
+		} else if login {
+			s.mu.Lock()
+			s.token = ""
+			s.mu.Unlock()
+			if err := s.ensureToken(ctx); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if leaseID != "" && !leaseEnd.IsZero() && renewalDue(leaseEnd, leaseTTL) <= time.Second {
+		resp, _, err := s.request(ctx, http.MethodPut, "/v1/sys/leases/renew", map[string]string{"lease_id": leaseID})
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.leaseTTL = time.Duration(resp.LeaseDuration) * time.Second
+		s.leaseEnd = time.Now().Add(s.leaseTTL)
+		s.mu.Unlock()
+		log.Debugf("--> Renewed lease of Vault secret '%s'", s.Path)
+	}
+	return nil
+}
+
+// Sends a request to Vault. Returns the decoded response and the HTTP status.
+func (s *VaultSource) request(ctx context.Context, method string, path string, body interface{}) (*vaultResponse, int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	s.mu.Lock()
+	address, token := s.address, s.token
+	s.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, method, address+path, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if s.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := s.Client
+	if client == nil {
+		timeout := s.Timeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var decoded vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil && err != io.EOF {
+		return nil, resp.StatusCode, fmt.Errorf("%s: invalid response: %v", resp.Status, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		if len(decoded.Errors) > 0 {
+			return nil, resp.StatusCode, fmt.Errorf("%s: %s", resp.Status, strings.Join(decoded.Errors, "; "))
+		}
+		return nil, resp.StatusCode, fmt.Errorf("%s", resp.Status)
+	}
+	return &decoded, resp.StatusCode, nil
+}
+
+// Returns how long until something that expires at end, after a lifetime of
+// ttl, should be renewed: when a third of its lifetime is left.
+func renewalDue(end time.Time, ttl time.Duration) time.Duration {
+	return time.Until(end) - ttl/3
+}
+
+func (s *VaultSource) mount() string {
+	if s.Mount == "" {
+		return "secret"
+	}
+	return strings.Trim(s.Mount, "/")
+}
@@ -0,0 +1,165 @@
+package appconfig
+
+import "context"
+import "encoding/json"
+import "fmt"
+import "net/http"
+import "net/http/httptest"
+import "sync"
+import "testing"
+import "time"
+
+// A Vault stand-in with an AppRole login that issues a new token each time,
+// tokens that can be revoked and a KV version 2 secret at secret/myapp/db.
+type testVaultServer struct {
+	mu         sync.Mutex
+	logins     int
+	tokenTTL   int             // lease_duration of issued tokens, in seconds
+	valid      map[string]bool // tokens that haven't been revoked
+	renewable  bool            // whether renew-self succeeds
+	renewCalls int
+}
+
+func (s *testVaultServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors": ["invalid role or secret ID"]}`)
+			return
+		}
+		s.logins++
+		token := fmt.Sprintf("token-%d", s.logins)
+		s.valid[token] = true
+		fmt.Fprintf(w, `{"auth": {"client_token": "%s", "lease_duration": %d, "renewable": true}}`, token, s.tokenTTL)
+		return
+	}
+	if !s.valid[r.Header.Get("X-Vault-Token")] {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"errors": ["permission denied"]}`)
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/secret/data/myapp/db":
+		fmt.Fprint(w, `{"data": {"data": {"password": "hunter2", "user": "app"}, "metadata": {"version": 3}}}`)
+	case "/v1/auth/token/lookup-self":
+		fmt.Fprintf(w, `{"data": {"ttl": %d, "creation_ttl": %d, "renewable": true}}`, s.tokenTTL, s.tokenTTL)
+	case "/v1/auth/token/renew-self":
+		s.renewCalls++
+		if !s.renewable {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors": ["token is past its max TTL"]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"auth": {"client_token": "%s", "lease_duration": %d}}`, r.Header.Get("X-Vault-Token"), s.tokenTTL)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *testVaultServer) revokeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.valid = make(map[string]bool)
+}
+
+func TestVaultSourceAppRoleLogin(t *testing.T) {
+	server := &testVaultServer{tokenTTL: 3600, valid: make(map[string]bool)}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	source := &VaultSource{Address: ts.URL, Path: "myapp/db", RoleID: "role", SecretID: "secret", Fields: map[string]string{"password": "db-password"}}
+	tree, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Values) != 1 || tree.Values["db-password"] != "hunter2" || !tree.Sensitive {
+		t.Errorf("got %v (sensitive %v), want only db-password, sensitive", tree.Values, tree.Sensitive)
+	}
+	if source.version != 3 {
+		t.Errorf("got version %v, want 3", source.version)
+	}
+
+	// The token from the login is reused while it is valid, and replaced by
+	// logging in again once it has been revoked
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	server.revokeAll()
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if server.logins != 2 || source.token != "token-2" {
+		t.Errorf("got %d logins and token %s, want a second login after the revocation", server.logins, source.token)
+	}
+
+	// A given token isn't replaced by a login
+	server.revokeAll()
+	static := &VaultSource{Address: ts.URL, Path: "myapp/db", Token: "revoked", RoleID: "role", SecretID: "secret"}
+	if _, err := static.Load(context.Background()); err == nil {
+		t.Error("no error with a revoked static token")
+	}
+}
+
+func TestVaultSourceRenewLogsInAgain(t *testing.T) {
+	server := &testVaultServer{tokenTTL: 1, valid: make(map[string]bool)}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	source := &VaultSource{Address: ts.URL, Path: "myapp/db", RoleID: "role", SecretID: "secret"}
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A token with a third of its lifetime left is renewed
+	server.renewable = true
+	if err := source.renew(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if server.renewCalls != 1 || server.logins != 1 {
+		t.Errorf("got %d renewals and %d logins, want the token renewed", server.renewCalls, server.logins)
+	}
+
+	// A token that can't be renewed any more is replaced by logging in again
+	server.renewable = false
+	if err := source.renew(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if server.logins != 2 || source.token != "token-2" {
+		t.Errorf("got %d logins and token %s, want a second login", server.logins, source.token)
+	}
+	if until := time.Until(source.expires); until <= 0 || until > time.Second {
+		t.Errorf("token expires in %v, want the TTL of the new token", until)
+	}
+}
+
+func TestVaultSourceRenewsGivenToken(t *testing.T) {
+	server := &testVaultServer{tokenTTL: 1, valid: map[string]bool{"given": true}, renewable: true}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	source := &VaultSource{Address: ts.URL, Path: "myapp/db", Token: "given"}
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if source.expires.IsZero() || source.tokenTTL != time.Second {
+		t.Fatalf("got expiry %v and TTL %v, want those from lookup-self", source.expires, source.tokenTTL)
+	}
+	if err := source.renew(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if server.renewCalls != 1 || server.logins != 0 || source.token != "given" {
+		t.Errorf("got %d renewals, %d logins and token %s, want the given token renewed", server.renewCalls, server.logins, source.token)
+	}
+}
+
+func TestRenewalDue(t *testing.T) {
+	if due := renewalDue(time.Now().Add(time.Hour), time.Hour); due < 39*time.Minute || due > 40*time.Minute {
+		t.Errorf("got %v, want renewal with a third of the lifetime left", due)
+	}
+	if due := renewalDue(time.Now().Add(-time.Minute), time.Hour); due > 0 {
+		t.Errorf("got %v for an expired token, want now", due)
+	}
+}
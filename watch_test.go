@@ -0,0 +1,79 @@
+package appconfig
+
+import "context"
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+
+func TestWatchConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.json")
+	argsFile := filepath.Join(dir, "app.args")
+	if err := os.WriteFile(configFile, []byte(`{"port": 80, "name": "file"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(argsFile, []byte("-name=args"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdinWriter.WriteString(`{"level": 3}`)
+	stdinWriter.Close()
+	args, stdin := os.Args, os.Stdin
+	os.Args, os.Stdin = []string{"app", "-config=" + configFile, "@" + argsFile, "-stdin"}, stdinReader
+	defer func() { os.Args, os.Stdin = args, stdin }()
+
+	params := map[string]Param{
+		"config": {Type: PARAM_CONFIG_JSON_FILE},
+		"stdin":  {Type: PARAM_CONFIG_JSON_STDIN},
+		"port":   {Type: PARAM_INT},
+		"level":  {Type: PARAM_INT},
+		"name":   {},
+	}
+	config, err := NewConfigWithOptions(params, Options{FilePollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The args file is gone by the time of the reload, and stdin has been
+	// drained: both are reused as read at startup
+	if err := os.Remove(argsFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configFile, []byte(`{"port": 81, "name": "file"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var reloaded Config
+	var reloadErr error
+	err = config.Watch(ctx, func(c Config, err error) {
+		reloaded, reloadErr = c, err
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Fatalf("got %v, want a reload for the changed config file", err)
+	}
+	if reloadErr != nil {
+		t.Fatal(reloadErr)
+	}
+	if reloaded.Get("port") != 81 || reloaded.Get("name") != "args" || reloaded.Get("level") != 3 {
+		t.Errorf("got port %v, name %v, level %v, want 81, args, 3", reloaded.Get("port"), reloaded.Get("name"), reloaded.Get("level"))
+	}
+}
+
+func TestWatchWithoutWatchableSources(t *testing.T) {
+	args := os.Args
+	os.Args = []string{"app"}
+	defer func() { os.Args = args }()
+	config, err := NewConfigWithOptions(map[string]Param{"config": {Type: PARAM_CONFIG_JSON_FILE}, "port": {Type: PARAM_INT}}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Watch(context.Background(), func(Config, error) {}); err == nil {
+		t.Error("no error without config files or watchable sources")
+	}
+}
@@ -0,0 +1,112 @@
+package appconfig
+
+import "fmt"
+
+import "gopkg.in/yaml.v3"
+
+// Parses a YAML config document into the same shape as parseJsonDocument():
+// objects become map[string]interface{}, sequences []interface{} and numbers
+// float64, together with the position of every key by docPath().
+// An empty document is an empty object.
+func parseYamlDocument(data []byte, name string) (map[string]interface{}, map[string]position, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, nil, fmt.Errorf("Invalid YAML in '%s': %v.", name, err)
+	}
+	positions := make(map[string]position)
+	if len(root.Content) == 0 {
+		return make(map[string]interface{}), positions, nil
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("YAML document '%s' must be a mapping at line %d, column %d.", name, doc.Line, doc.Column)
+	}
+	d := &yamlDecoder{name: name, positions: positions, budget: yamlAliasRatio*countYamlNodes(doc) + yamlAliasAllowance}
+	value, err := d.value(doc, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value.(map[string]interface{}), positions, nil
+}
+
+// Aliases are expanded, so a small document can reference anchors that
+// reference anchors ("billion laughs") until it exhausts memory. Documents
+// may expand to at most yamlAliasRatio times their own number of nodes, plus
+// yamlAliasAllowance.
+const yamlAliasRatio = 100
+const yamlAliasAllowance = 10000
+
+type yamlDecoder struct {
+	name      string
+	positions map[string]position
+	budget    int // nodes that may still be decoded
+}
+
+// Counts the nodes of a document without following aliases.
+func countYamlNodes(node *yaml.Node) int {
+	n := 1
+	for _, child := range node.Content {
+		n += countYamlNodes(child)
+	}
+	return n
+}
+
+func (d *yamlDecoder) value(node *yaml.Node, path []string) (interface{}, error) {
+	name, positions := d.name, d.positions
+	if d.budget--; d.budget < 0 {
+		return nil, fmt.Errorf("YAML document '%s' expands aliases excessively at line %d, column %d.", name, node.Line, node.Column)
+	}
+	switch node.Kind {
+	case yaml.AliasNode:
+		return d.value(node.Alias, path)
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			if keyNode.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("Non-scalar key in YAML document '%s' at line %d, column %d.", name, keyNode.Line, keyNode.Column)
+			}
+			if keyNode.Tag == "!!merge" { // "<<: *anchor"
+				merged, err := d.value(valueNode, path)
+				if err != nil {
+					return nil, err
+				}
+				if mergedMap, ok := merged.(map[string]interface{}); ok {
+					for key, value := range mergedMap {
+						if _, exists := m[key]; !exists {
+							m[key] = value
+						}
+					}
+				}
+				continue
+			}
+			keyPath := append(append([]string{}, path...), keyNode.Value)
+			positions[docPath(keyPath...)] = position{line: keyNode.Line, column: keyNode.Column}
+			value, err := d.value(valueNode, keyPath)
+			if err != nil {
+				return nil, err
+			}
+			m[keyNode.Value] = value
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		list := make([]interface{}, 0, len(node.Content))
+		for _, item := range node.Content {
+			value, err := d.value(item, path)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	}
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, fmt.Errorf("Invalid YAML value in '%s' at line %d, column %d: %v.", name, node.Line, node.Column, err)
+	}
+	if i, ok := value.(int); ok { // JSON numbers are float64
+		return float64(i), nil
+	}
+	return value, nil
+}